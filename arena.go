@@ -0,0 +1,137 @@
+package htbapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Arena is the product a machine is played in. It decides which endpoints are
+// used to spawn, stop, reset, extend and own a machine and which vpn server it is reached by.
+type Arena int
+
+const (
+	// Lab is the regular lab. VIP and VIP+ subscribers play the retired machines
+	// there as well, the api does not tell these servers apart.
+	Lab Arena = iota
+	// StartingPoint holds the beginner machines of Starting Point. They are spawned
+	// like lab machines but are reached by their own vpn server.
+	StartingPoint
+	// ReleaseArena holds the newly released machine on personal instances
+	ReleaseArena
+)
+
+// arenaEndpoints are the endpoints of an Arena
+type arenaEndpoints struct {
+	name      string
+	spawn     string
+	active    string
+	terminate string
+	own       string
+	reset     string
+	extend    string
+	vote      string
+	accept    string
+	vpn       string
+	// single arenas only hold one machine, so requests carry no machine id
+	single bool
+}
+
+// labEndpoints are the endpoints of the lab, Starting Point shares them
+var labEndpoints = arenaEndpoints{
+	spawn:     "/vm/spawn",
+	active:    "/machine/active",
+	terminate: "/vm/terminate",
+	own:       "/machine/own",
+	reset:     "/vm/reset",
+	extend:    "/vm/extend",
+	vote:      "/vm/reset/vote",
+	accept:    "/vm/reset/vote/accept",
+	vpn:       "lab",
+}
+
+// releaseArenaEndpoints are the endpoints of the release arena
+var releaseArenaEndpoints = arenaEndpoints{
+	spawn:     "/release_arena/spawn",
+	active:    "/release_arena/active",
+	terminate: "/release_arena/terminate",
+	own:       "/release_arena/own",
+	reset:     "/release_arena/reset",
+	extend:    "/release_arena/extend",
+	vote:      "/release_arena/reset/vote",
+	accept:    "/release_arena/reset/vote/accept",
+	vpn:       "release_arena",
+	single:    true,
+}
+
+// arenas holds the endpoints of every Arena
+var arenas = map[Arena]arenaEndpoints{
+	Lab:           withName(labEndpoints, "lab"),
+	StartingPoint: withVPN(withName(labEndpoints, "starting_point"), "starting_point"),
+	ReleaseArena:  withName(releaseArenaEndpoints, "release_arena"),
+}
+
+// withName returns e named name
+func withName(e arenaEndpoints, name string) arenaEndpoints {
+	e.name = name
+	return e
+}
+
+// withVPN returns e using the vpn endpoint vpn
+func withVPN(e arenaEndpoints, vpn string) arenaEndpoints {
+	e.vpn = vpn
+	return e
+}
+
+// ParseArena returns the Arena named name, e.g. "release_arena"
+func ParseArena(name string) (Arena, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for a, e := range arenas {
+		if e.name == name {
+			return a, nil
+		}
+	}
+
+	return Lab, fmt.Errorf("unknown arena %q", name)
+}
+
+// String returns the name of the arena
+func (a Arena) String() string {
+	if e, ok := arenas[a]; ok {
+		return e.name
+	}
+
+	return fmt.Sprintf("Arena(%d)", int(a))
+}
+
+// VPNEndpoint returns the key of the vpn server of the arena, see EnumVPNEndpoints
+func (a Arena) VPNEndpoint() string {
+	return arenas[a].vpn
+}
+
+// endpoints returns the endpoints of the arena
+func (a Arena) endpoints() (arenaEndpoints, error) {
+	e, ok := arenas[a]
+	if !ok {
+		return e, fmt.Errorf("unknown arena %s", a)
+	}
+
+	return e, nil
+}
+
+// machineBody returns the json payload identifying machine id
+func (e arenaEndpoints) machineBody(id int) interface{} {
+	if e.single {
+		return nil
+	}
+
+	return machineIDBody{MachineID: id}
+}
+
+// arenaOf maps the releaseArena switch of the deprecated methods to an Arena
+func arenaOf(releaseArena bool) Arena {
+	if releaseArena {
+		return ReleaseArena
+	}
+
+	return Lab
+}
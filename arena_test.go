@@ -0,0 +1,40 @@
+package htbapi_test
+
+import (
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+func TestArenas(t *testing.T) {
+	tests := []struct {
+		arena htbapi.Arena
+		name  string
+		vpn   string
+	}{
+		{htbapi.Lab, "lab", "lab"},
+		{htbapi.StartingPoint, "starting_point", "starting_point"},
+		{htbapi.ReleaseArena, "release_arena", "release_arena"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.arena.String(); got != tt.name {
+			t.Errorf("String = %q, want %q", got, tt.name)
+		}
+		if got := tt.arena.VPNEndpoint(); got != tt.vpn {
+			t.Errorf("%s: VPNEndpoint = %q, want %q", tt.name, got, tt.vpn)
+		}
+		if got, err := htbapi.ParseArena(" " + tt.name + " "); err != nil || got != tt.arena {
+			t.Errorf("ParseArena(%q) = %v, %v, want %v", tt.name, got, err, tt.arena)
+		}
+	}
+
+	for _, name := range []string{"vip", "vip_plus", "competitive", ""} {
+		if _, err := htbapi.ParseArena(name); err == nil {
+			t.Errorf("ParseArena(%q): want an error", name)
+		}
+	}
+	if got := htbapi.Arena(42).String(); got != "Arena(42)" {
+		t.Errorf("String of unknown arena = %q", got)
+	}
+}
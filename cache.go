@@ -0,0 +1,439 @@
+package htbapi
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedResponse is a GET response stored in a Cache
+type CachedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+	Expires      time.Time   `json:"expires"`
+}
+
+// Fresh reports whether the response can be served without asking the api
+func (c *CachedResponse) Fresh() bool {
+	return time.Now().Before(c.Expires)
+}
+
+// response builds a http response serving the cached body
+func (c *CachedResponse) response() *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+	}
+}
+
+// Cache stores GET responses by key. Implementations have to be safe for concurrent use.
+type Cache interface {
+	// Get returns the response stored under key
+	Get(key string) (*CachedResponse, bool)
+	// Set stores r under key
+	Set(key string, r *CachedResponse)
+	// Delete removes the response stored under key
+	Delete(key string)
+	// Clear removes all responses
+	Clear()
+}
+
+// CachePolicy decides how long responses of an endpoint are fresh.
+// Endpoints are matched by their longest prefix in TTL. Endpoints without
+// a positive TTL are not cached.
+type CachePolicy struct {
+	TTL        map[string]time.Duration
+	DefaultTTL time.Duration
+}
+
+// DefaultCachePolicy caches the lists and profiles of machines and challenges
+// and the vpn connections. The active machine is never cached.
+func DefaultCachePolicy() CachePolicy {
+	return CachePolicy{
+		TTL: map[string]time.Duration{
+			"/machine/list":     5 * time.Minute,
+			"/machine/profile/": 5 * time.Minute,
+			"/challenge/list":   5 * time.Minute,
+			"/challenge/info/":  5 * time.Minute,
+			"/connections":      time.Minute,
+		},
+	}
+}
+
+// ttl returns how long a response of endpoint is fresh
+func (p CachePolicy) ttl(endpoint string) time.Duration {
+	ttl, longest := p.DefaultTTL, -1
+	for prefix, d := range p.TTL {
+		if strings.HasPrefix(endpoint, prefix) && len(prefix) > longest {
+			ttl, longest = d, len(prefix)
+		}
+	}
+
+	return ttl
+}
+
+// responseCache is the cache of an API
+type responseCache struct {
+	store  Cache
+	policy CachePolicy
+	// generation is increased on every invalidation, so responses of requests
+	// which were in flight meanwhile are not stored
+	generation int64
+}
+
+// WithCache caches GET responses in c according to policy. Stale responses are
+// revalidated with If-None-Match and If-Modified-Since if the api sent an ETag or
+// Last-Modified header. Every successful authorized request with another method
+// clears c, as spawning, terminating or owning a machine changes most responses.
+func WithCache(c Cache, policy CachePolicy) Option {
+	return func(a *API) error {
+		if c == nil {
+			return fmt.Errorf("%s", "cache must not be nil")
+		}
+
+		a.cache = &responseCache{store: c, policy: policy}
+		return nil
+	}
+}
+
+// ClearCache removes all cached responses
+func (a *API) ClearCache() {
+	if a.cache != nil {
+		a.cache.invalidate()
+	}
+}
+
+// invalidate removes all cached responses
+func (c *responseCache) invalidate() {
+	atomic.AddInt64(&c.generation, 1)
+	c.store.Clear()
+}
+
+// sendCached sends r through the cache
+func (a *API) sendCached(ctx context.Context, r *Request, token string) (*http.Response, error) {
+	c := a.cache
+
+	switch r.method {
+	case http.MethodGet:
+	case http.MethodHead, http.MethodOptions:
+		return a.send(ctx, r, token)
+	default:
+		resp, err := a.send(ctx, r, token)
+		// Logging in or refreshing the token changes no responses
+		if err == nil && resp.StatusCode < 400 && r.authorized {
+			c.invalidate()
+		}
+		return resp, err
+	}
+
+	ttl := c.policy.ttl(r.endpoint)
+	if ttl <= 0 {
+		return a.send(ctx, r, token)
+	}
+
+	key := cacheKey(token, r)
+	cached, ok := c.store.Get(key)
+	if r.noCache || bypassCache(ctx) {
+		// Ask the api and only use the response to refresh the cache
+		ok = false
+	}
+	if ok && cached.Fresh() {
+		return cached.response(), nil
+	}
+
+	send := r
+	if ok && (cached.ETag != "" || cached.LastModified != "") {
+		conditional := *r
+		conditional.header = r.header.Clone()
+		if cached.ETag != "" {
+			conditional.header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			conditional.header.Set("If-Modified-Since", cached.LastModified)
+		}
+		send = &conditional
+	}
+
+	generation := atomic.LoadInt64(&c.generation)
+
+	resp, err := a.send(ctx, send, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && ok {
+		drainBody(resp.Body)
+
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			cached.ETag = etag
+		}
+		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+			cached.LastModified = lastModified
+		}
+		cached.Expires = time.Now().Add(ttl)
+		if atomic.LoadInt64(&c.generation) == generation {
+			c.store.Set(key, cached)
+		}
+
+		return cached.response(), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		// Too large to cache, hand it over as it is
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	header := http.Header{}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		header.Set("Content-Type", ct)
+	}
+
+	if atomic.LoadInt64(&c.generation) == generation {
+		c.store.Set(key, &CachedResponse{
+			StatusCode:   resp.StatusCode,
+			Header:       header,
+			Body:         data,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Expires:      time.Now().Add(ttl),
+		})
+	}
+
+	return resp, nil
+}
+
+// noCacheKey marks a context whose requests skip cached responses
+type noCacheKey struct{}
+
+// withoutCache returns ctx making all requests sent with it skip cached responses
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// bypassCache reports whether ctx was created by withoutCache
+func bypassCache(ctx context.Context) bool {
+	bypass, _ := ctx.Value(noCacheKey{}).(bool)
+	return bypass
+}
+
+// cacheKey returns the key of r. It contains the subject of the token so users
+// sharing a cache never see responses of each other.
+func cacheKey(token string, r *Request) string {
+	user := ""
+	if token != "" {
+		if claims, err := ParseToken(token); err == nil && claims.Subject != "" {
+			user = claims.Subject
+		} else {
+			sum := sha256.Sum256([]byte(token))
+			user = hex.EncodeToString(sum[:8])
+		}
+	}
+
+	return user + " " + r.method + " " + r.url()
+}
+
+// LRUCache is an in memory Cache evicting the least recently used response
+// once it holds more than its size
+type LRUCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// lruEntry is an element of LRUCache.order
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewLRUCache returns a LRUCache holding up to size responses
+func NewLRUCache(size int) *LRUCache {
+	if size < 1 {
+		size = 1
+	}
+
+	return &LRUCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get implements Cache
+func (c *LRUCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	r := *e.Value.(*lruEntry).response
+	return &r, true
+}
+
+// Set implements Cache
+func (c *LRUCache) Set(key string, r *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry).response = r
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: r})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Delete implements Cache
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// Clear implements Cache
+func (c *LRUCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// Len returns the number of cached responses
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// DiskCache is a Cache keeping every response in its own file within a directory,
+// so it survives restarts of the program
+type DiskCache struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+// NewDiskCache returns a DiskCache writing to dir. The directory is created if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get implements Cache
+func (c *DiskCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var r CachedResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, false
+	}
+
+	return &r, true
+}
+
+// Set implements Cache
+func (c *DiskCache) Set(key string, r *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	// A response which cannot be written is simply not cached
+	_ = writeFileAtomic(c.path(key), data, 0600)
+}
+
+// Delete implements Cache
+func (c *DiskCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	os.Remove(c.path(key))
+}
+
+// Clear implements Cache
+func (c *DiskCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		os.Remove(f)
+	}
+}
+
+// path returns the file of key
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
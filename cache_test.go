@@ -0,0 +1,283 @@
+package htbapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+func TestCacheHit(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newTestAPI(t, s, htbapi.WithCache(htbapi.NewLRUCache(10), htbapi.DefaultCachePolicy()))
+
+	for i := 0; i < 3; i++ {
+		m, err := a.Machines.Get(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if m.Name != "Lame" {
+			t.Errorf("Get name = %q, want Lame", m.Name)
+		}
+	}
+
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1"); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	c := htbapi.NewLRUCache(10)
+	a := newTestAPI(t, s, htbapi.WithCache(c, htbapi.DefaultCachePolicy()))
+	ctx := context.Background()
+
+	if _, err := a.Machines.Get(ctx, 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp, err := a.NewRequest(http.MethodPost, "/vm/spawn").JSON(map[string]int{"machine_id": 1}).Do(ctx)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if c.Len() != 0 {
+		t.Errorf("cache holds %d responses after a POST, want 0", c.Len())
+	}
+
+	m, err := a.Machines.Get(ctx, 1)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1"); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+	if !m.PlayInfo.IsActive {
+		t.Error("Get after spawning served the stale machine")
+	}
+
+	// Failed requests do not clear the cache
+	if _, err := a.Machines.Spawn(ctx, 1, htbapi.Lab); err == nil {
+		t.Fatal("Spawn twice: want an error")
+	}
+	if c.Len() == 0 {
+		t.Error("cache was cleared by a failed POST")
+	}
+
+	a.ClearCache()
+	if c.Len() != 0 {
+		t.Errorf("cache holds %d responses after ClearCache, want 0", c.Len())
+	}
+}
+
+func TestCacheNoCache(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newTestAPI(t, s, htbapi.WithCache(htbapi.NewLRUCache(10), htbapi.DefaultCachePolicy()))
+	ctx := context.Background()
+
+	if _, err := a.Machines.Get(ctx, 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	resp, err := a.NewRequest(http.MethodGet, "/machine/profile/1").NoCache().Do(ctx)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1"); n != 2 {
+		t.Errorf("%d requests with NoCache, want 2", n)
+	}
+
+	// The response of the bypassing request refreshed the cache
+	if _, err := a.Machines.Get(ctx, 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1"); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+// conditionalServer serves /data with an ETag or Last-Modified and answers
+// matching conditional requests with 304
+type conditionalServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    int
+	conditional int
+}
+
+func newConditionalServer(t *testing.T, etag, lastModified string) *conditionalServer {
+	cs := &conditionalServer{}
+	cs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		cs.requests++
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+
+		if (etag != "" && r.Header.Get("If-None-Match") == etag) ||
+			(lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified) {
+			cs.conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"value":"cached"}`))
+	}))
+	t.Cleanup(cs.Close)
+
+	return cs
+}
+
+func (cs *conditionalServer) counts() (requests, conditional int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.requests, cs.conditional
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	tests := []struct {
+		name, etag, lastModified string
+	}{
+		{"etag", `"abc"`, ""},
+		{"last modified", "", "Sat, 17 Oct 2026 10:00:00 GMT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newConditionalServer(t, tt.etag, tt.lastModified)
+			a, err := htbapi.New(
+				htbapi.WithBaseURL(cs.URL),
+				htbapi.WithRetryPolicy(htbapi.RetryPolicy{MaxAttempts: 1}),
+				// Every response is stale right away and has to be revalidated
+				htbapi.WithCache(htbapi.NewLRUCache(10), htbapi.CachePolicy{DefaultTTL: time.Nanosecond}),
+			)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			for i := 0; i < 3; i++ {
+				v, err := htbapi.Fetch[map[string]string](context.Background(), a.NewRequest(http.MethodGet, "/data").Unauthorized())
+				if err != nil {
+					t.Fatalf("Fetch %d: %v", i, err)
+				}
+				if v["value"] != "cached" {
+					t.Errorf("Fetch %d = %v, want the cached body", i, v)
+				}
+			}
+
+			if requests, conditional := cs.counts(); requests != 3 || conditional != 2 {
+				t.Errorf("%d requests of which %d conditional, want 3 and 2", requests, conditional)
+			}
+		})
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := htbapi.NewLRUCache(2)
+	c.Set("a", &htbapi.CachedResponse{Body: []byte("a")})
+	c.Set("b", &htbapi.CachedResponse{Body: []byte("b")})
+
+	// Using a makes b the least recently used response
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a): not cached")
+	}
+	c.Set("c", &htbapi.CachedResponse{Body: []byte("c")})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b): want it evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if r, ok := c.Get(key); !ok || string(r.Body) != key {
+			t.Errorf("Get(%s) = %v, %v, want it cached", key, r, ok)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get(a) after Delete: want it removed")
+	}
+	c.Clear()
+	if c.Len() != 0 {
+		t.Errorf("Len after Clear = %d, want 0", c.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := htbapi.NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+
+	want := &htbapi.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       []byte(`{"value":1}`),
+		ETag:       `"abc"`,
+		Expires:    time.Now().Add(time.Hour).Round(0),
+	}
+	c.Set("a", want)
+	c.Set("b", want)
+
+	// A new cache in the same directory sees the responses of the old one
+	c, err = htbapi.NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache: %v", err)
+	}
+	got, ok := c.Get("a")
+	if !ok {
+		t.Fatal("Get(a): not cached")
+	}
+	if string(got.Body) != string(want.Body) || got.ETag != want.ETag || !got.Expires.Equal(want.Expires) ||
+		got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Get(a) = %+v, want %+v", got, want)
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get(a) after Delete: want it removed")
+	}
+	c.Clear()
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) after Clear: want it removed")
+	}
+}
+
+func TestDiskCacheAcrossClients(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	dir := t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		c, err := htbapi.NewDiskCache(dir)
+		if err != nil {
+			t.Fatalf("NewDiskCache: %v", err)
+		}
+		a := newTestAPI(t, s, htbapi.WithCache(c, htbapi.DefaultCachePolicy()))
+		if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1"); n != 1 {
+		t.Errorf("%d requests, want 1 served from the disk cache", n)
+	}
+}
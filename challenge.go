@@ -1,8 +1,10 @@
 package htbapi
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"strconv"
 )
 
@@ -76,46 +78,110 @@ type GetChallengeRepsonse struct {
 	Challenge Challenge `json:"challenge"`
 }
 
-// GetAllChallenges will return you all challenges either retired=true or retired=false (the active ones)
-func (a *API) GetAllChallenges(retired bool) ([]Challenge, error) {
-	var endpoint string
-	switch retired {
-	case true:
+// ChallengesService handles the challenges
+type ChallengesService service
+
+// challengeOwnBody is the json payload of /challenge/own
+type challengeOwnBody struct {
+	ChallengeID int    `json:"challenge_id"`
+	Difficulty  int    `json:"difficulty"`
+	Flag        string `json:"flag"`
+}
+
+// List returns the active challenges or the retired ones if retired is true
+func (s *ChallengesService) List(ctx context.Context, retired bool) ([]Challenge, error) {
+	endpoint := "/challenge/list"
+	if retired {
 		endpoint = "/challenge/list/retired"
-	case false:
-		endpoint = "/challenge/list"
-	default:
-		return nil, nil
 	}
 
-	body, _, err := a.DoRequest(endpoint, nil, true, false)
+	resp, err := Do[GetChallengesResponse](ctx, s.api, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer body.Close()
 
-	var respMessage GetChallengesResponse
-	if err := json.NewDecoder(body).Decode(&respMessage); err != nil {
-		return nil, err
+	return resp.Challenges, nil
+}
+
+// Iter returns an iterator over the active challenges or the retired ones if retired
+// is true. It follows the pages if the api paginates the list.
+func (s *ChallengesService) Iter(ctx context.Context, retired bool) *Iterator[Challenge] {
+	endpoint := "/challenge/list"
+	if retired {
+		endpoint = "/challenge/list/retired"
 	}
 
-	return respMessage.Challenges, nil
+	return NewIterator(ctx, func(ctx context.Context, page int) (Page[Challenge], error) {
+		return listPage[Challenge](ctx, s.api, endpoint, page, "challenges")
+	})
 }
 
-// GetChallenge will return you a certain challenge by id
-func (a *API) GetChallenge(id int) (Challenge, error) {
-	sID := strconv.Itoa(id)
-
-	body, _, err := a.DoRequest(fmt.Sprintf("/challenge/info/%s", sID), nil, true, false)
+// Get returns the challenge with id
+func (s *ChallengesService) Get(ctx context.Context, id int) (Challenge, error) {
+	resp, err := Do[GetChallengeRepsonse](ctx, s.api, http.MethodGet, fmt.Sprintf("/challenge/info/%s", strconv.Itoa(id)), nil)
 	if err != nil {
 		return Challenge{}, err
 	}
-	defer body.Close()
 
-	var respMessage GetChallengeRepsonse
-	if err := json.NewDecoder(body).Decode(&respMessage); err != nil {
-		return Challenge{}, err
+	return resp.Challenge, nil
+}
+
+// Download writes the files of the challenge with id to w. HTB serves them as
+// password protected zip archive. It returns the number of bytes written.
+func (s *ChallengesService) Download(ctx context.Context, id int, w io.Writer) (int64, error) {
+	endpoint := fmt.Sprintf("/challenge/download/%s", strconv.Itoa(id))
+
+	resp, err := s.api.NewRequest(http.MethodGet, endpoint).Header("Accept", "application/zip, application/octet-stream").Do(ctx)
+	if err != nil {
+		return 0, err
 	}
+	defer drainBody(resp.Body)
+
+	if err := checkResponse(http.MethodGet, endpoint, resp.StatusCode, resp.Body); err != nil {
+		return 0, err
+	}
+
+	return io.Copy(w, resp.Body)
+}
+
+// Submit submits a flag for the challenge with id. The difficulty rating goes from 1 to 10.
+// A wrong flag is reported as an *APIError matching ErrIncorrectFlag, the response then tells why.
+func (s *ChallengesService) Submit(ctx context.Context, id int, flag string, difficulty int) (SubmissionResponse, error) {
+	if difficulty < 1 || difficulty > 10 {
+		return SubmissionResponse{}, fmt.Errorf("%s", "Difficulty has to be between 1 and 10")
+	}
+
+	return submitFlag(ctx, s.api, "/challenge/own", challengeOwnBody{
+		ChallengeID: id,
+		Difficulty:  difficulty * 10,
+		Flag:        flag,
+	})
+}
+
+// GetAllChallenges will return you all challenges either retired=true or retired=false (the active ones)
+//
+// Deprecated: Use a.Challenges.List.
+func (a *API) GetAllChallenges(retired bool) ([]Challenge, error) {
+	return a.Challenges.List(context.Background(), retired)
+}
+
+// GetAllChallengesContext is like GetAllChallenges but uses ctx for the request.
+//
+// Deprecated: Use a.Challenges.List.
+func (a *API) GetAllChallengesContext(ctx context.Context, retired bool) ([]Challenge, error) {
+	return a.Challenges.List(ctx, retired)
+}
+
+// GetChallenge will return you a certain challenge by id
+//
+// Deprecated: Use a.Challenges.Get.
+func (a *API) GetChallenge(id int) (Challenge, error) {
+	return a.Challenges.Get(context.Background(), id)
+}
 
-	return respMessage.Challenge, nil
+// GetChallengeContext is like GetChallenge but uses ctx for the request.
+//
+// Deprecated: Use a.Challenges.Get.
+func (a *API) GetChallengeContext(ctx context.Context, id int) (Challenge, error) {
+	return a.Challenges.Get(ctx, id)
 }
@@ -0,0 +1,104 @@
+package htbapi
+
+import (
+	"context"
+	"io"
+)
+
+// service is the common base of all services. They all share one per API.
+type service struct {
+	api *API
+}
+
+// MachineClient covers all operations of MachinesService. Depend on it instead of
+// *API to swap in a fake in tests, e.g. htbtest.MockMachines.
+type MachineClient interface {
+	List(ctx context.Context, retired bool) ([]Machine, error)
+	Get(ctx context.Context, id int) (Machine, error)
+	Query(ctx context.Context, q MachineQuery) *Iterator[Machine]
+	ReleaseArena(ctx context.Context) (Machine, error)
+	Active(ctx context.Context, arena Arena) (MachineInstance, error)
+	Spawn(ctx context.Context, id int, arena Arena) (MachineInstance, error)
+	SpawnAndWait(ctx context.Context, id int, arena Arena, opts WaitOptions) (MachineInstance, error)
+	WaitReady(ctx context.Context, arena Arena, opts WaitOptions) (MachineInstance, error)
+	Stop(ctx context.Context, id int, arena Arena) error
+	Submit(ctx context.Context, id int, flag string, difficulty int, arena Arena) (SubmissionResponse, error)
+	Reset(ctx context.Context, id int, arena Arena) (LifecycleResult, error)
+	Extend(ctx context.Context, id int, arena Arena) (LifecycleResult, error)
+	VoteReset(ctx context.Context, id int, arena Arena) (LifecycleResult, error)
+	AcceptResetVote(ctx context.Context, id int, arena Arena) (LifecycleResult, error)
+}
+
+// ChallengeClient covers all operations of ChallengesService
+type ChallengeClient interface {
+	List(ctx context.Context, retired bool) ([]Challenge, error)
+	Get(ctx context.Context, id int) (Challenge, error)
+	Iter(ctx context.Context, retired bool) *Iterator[Challenge]
+	Download(ctx context.Context, id int, w io.Writer) (int64, error)
+	Submit(ctx context.Context, id int, flag string, difficulty int) (SubmissionResponse, error)
+}
+
+// VPNClient covers all operations of VPNService
+type VPNClient interface {
+	Servers(ctx context.Context) (map[string]VPNServer, error)
+	Current(ctx context.Context, search string) (VPNServer, error)
+}
+
+// UserClient covers all operations of UsersService
+type UserClient interface {
+	Info(ctx context.Context) (UserInfo, error)
+	Profile(ctx context.Context, id int) (UserProfile, error)
+	Activity(ctx context.Context, id int) *Iterator[UserActivity]
+}
+
+// RankingClient covers all operations of RankingsService
+type RankingClient interface {
+	Users(ctx context.Context) *Iterator[Ranking]
+	Teams(ctx context.Context) *Iterator[Ranking]
+	Countries(ctx context.Context) *Iterator[Ranking]
+}
+
+// Client covers all operations of the api. *API implements it, depend on it or on
+// one of the smaller interfaces to swap in a fake in tests, e.g. htbtest.MockClient.
+// The services are fields of API, so their accessors are named after the interfaces.
+type Client interface {
+	MachineClient() MachineClient
+	ChallengeClient() ChallengeClient
+	VPNClient() VPNClient
+	UserClient() UserClient
+	RankingClient() RankingClient
+}
+
+// MachineClient implements Client, it returns a.Machines
+func (a *API) MachineClient() MachineClient {
+	return a.Machines
+}
+
+// ChallengeClient implements Client, it returns a.Challenges
+func (a *API) ChallengeClient() ChallengeClient {
+	return a.Challenges
+}
+
+// VPNClient implements Client, it returns a.VPN
+func (a *API) VPNClient() VPNClient {
+	return a.VPN
+}
+
+// UserClient implements Client, it returns a.Users
+func (a *API) UserClient() UserClient {
+	return a.Users
+}
+
+// RankingClient implements Client, it returns a.Rankings
+func (a *API) RankingClient() RankingClient {
+	return a.Rankings
+}
+
+var (
+	_ Client          = (*API)(nil)
+	_ MachineClient   = (*MachinesService)(nil)
+	_ ChallengeClient = (*ChallengesService)(nil)
+	_ VPNClient       = (*VPNService)(nil)
+	_ UserClient      = (*UsersService)(nil)
+	_ RankingClient   = (*RankingsService)(nil)
+)
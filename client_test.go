@@ -0,0 +1,83 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// lookup depends on the Client interface only
+func lookup(c htbapi.Client, id int) (htbapi.Machine, error) {
+	return c.MachineClient().Get(context.Background(), id)
+}
+
+func TestClient(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	m, err := lookup(a, 1)
+	if err != nil || m.Name != "Lame" {
+		t.Fatalf("lookup = %+v, %v", m, err)
+	}
+}
+
+func TestMockClient(t *testing.T) {
+	c := &htbtest.MockClient{}
+
+	if _, err := lookup(c, 1); !errors.Is(err, htbtest.ErrNotMocked) {
+		t.Fatalf("err = %v, want ErrNotMocked", err)
+	}
+
+	c.Machines.GetFunc = func(ctx context.Context, id int) (htbapi.Machine, error) {
+		return htbapi.Machine{ID: id, Name: "Lame"}, nil
+	}
+	m, err := lookup(c, 1)
+	if err != nil || m.Name != "Lame" {
+		t.Fatalf("lookup = %+v, %v", m, err)
+	}
+	if n := c.Machines.CallCount("Get"); n != 2 {
+		t.Errorf("Get called %d times, want 2", n)
+	}
+
+	if _, err := c.RankingClient().Users(context.Background()).All(); !errors.Is(err, htbtest.ErrNotMocked) {
+		t.Errorf("iterator err = %v, want ErrNotMocked", err)
+	}
+}
+
+func TestDeprecatedMachineMethods(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	if _, err := a.SpawnMachine(1, false); err != nil {
+		t.Fatalf("SpawnMachine: %v", err)
+	}
+	if id, ok := s.Spawned("lab"); !ok || id != 1 {
+		t.Fatalf("spawned = %d, %v", id, ok)
+	}
+
+	if _, err := a.SubmitFlag(1, "user", 5, false); err != nil {
+		t.Fatalf("SubmitFlag: %v", err)
+	}
+	if _, err := a.SubmitFlag(1, "wrong", 5, false); !errors.Is(err, htbapi.ErrIncorrectFlag) {
+		t.Fatalf("SubmitFlag of a wrong flag: %v", err)
+	}
+	if user, _ := s.Owns(1); !user {
+		t.Error("user flag not owned")
+	}
+
+	if err := a.StopMachine(1, false); err != nil {
+		t.Fatalf("StopMachine: %v", err)
+	}
+	if _, ok := s.Spawned("lab"); ok {
+		t.Error("machine still spawned")
+	}
+}
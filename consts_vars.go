@@ -1,5 +1,12 @@
 package htbapi
 
+const (
+	// DefaultBaseURL is the api endpoint used if no other one is set with WithBaseURL
+	DefaultBaseURL = "https://www.hackthebox.com/api/v4"
+	// DefaultDebugProxy is the proxy used by WithDebugFromEnv
+	DefaultDebugProxy = "http://127.0.0.1:8080"
+)
+
 var (
 	// EnumVPNEndpoints hold the possible vpn endpoints to fetch data
 	EnumVPNEndpoints = []string{"lab", "starting_point", "endgames", "fortresses", "pro_labs", "release_arena"}
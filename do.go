@@ -0,0 +1,69 @@
+package htbapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxResponseSize limits how much of a response body will be decoded
+const maxResponseSize = 32 << 20
+
+// Do sends an authorized request with method to path and decodes the json response
+// into T. body is marshaled to json unless it is nil; []byte and json.RawMessage are
+// sent as they are. Error responses are returned as *APIError.
+func Do[T any](ctx context.Context, a *API, method, path string, body interface{}) (T, error) {
+	return doJSON[T](ctx, a, method, path, body, true)
+}
+
+// doJSON is like Do but lets the caller choose if the request is authorized
+func doJSON[T any](ctx context.Context, a *API, method, path string, body interface{}, authorized bool) (T, error) {
+	r := a.NewRequest(method, path).JSON(body)
+	if !authorized {
+		r.Unauthorized()
+	}
+
+	return Fetch[T](ctx, r)
+}
+
+// decodeResponse checks the status of resp and decodes its json body into T.
+// The body is drained and closed so the connection can be reused.
+func decodeResponse[T any](resp *http.Response, method, path string) (T, error) {
+	var out T
+	defer drainBody(resp.Body)
+
+	if err := checkResponse(method, path, resp.StatusCode, resp.Body); err != nil {
+		return out, err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return out, err
+	}
+	if len(data) > maxResponseSize {
+		return out, fmt.Errorf("response of %s %s exceeds %d bytes", method, path, maxResponseSize)
+	}
+
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, fmt.Errorf("cannot decode response of %s %s: %w", method, path, err)
+	}
+
+	return out, nil
+}
+
+// marshalBody returns the json encoding of body or nil if there is none
+func marshalBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return b, nil
+	case json.RawMessage:
+		return b, nil
+	}
+
+	return json.Marshal(body)
+}
@@ -0,0 +1,150 @@
+package htbapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxErrorBodySize limits how much of an error response will be read into an APIError
+const maxErrorBodySize = 64 << 10
+
+var (
+	// ErrUnauthorized is matched by an APIError with status 401
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is matched by an APIError with status 404
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is matched by an APIError with status 429
+	ErrRateLimited = errors.New("rate limited")
+	// ErrMachineAlreadySpawned is matched by an APIError telling that another machine is spawned already
+	ErrMachineAlreadySpawned = errors.New("machine already spawned")
+	// ErrIncorrectFlag is matched by an APIError telling that a submitted flag was wrong
+	ErrIncorrectFlag = errors.New("incorrect flag")
+	// ErrCooldown is matched by an APIError telling that a machine was reset or extended too recently
+	ErrCooldown = errors.New("cooldown")
+)
+
+// APIError is returned when the api answers with an error. It can be checked
+// against the Err* variables by using errors.Is.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Endpoint   string
+	Message    string
+	Body       []byte
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether the error matches one of the Err* variables
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+
+	for _, m := range apiMessages {
+		if m.target == target && m.status[e.StatusCode] && m.pattern.MatchString(strings.TrimSpace(e.Message)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apiMessage is an error message of the api and the statuses it comes with
+type apiMessage struct {
+	target  error
+	status  map[int]bool
+	pattern *regexp.Regexp
+}
+
+// apiMessages are the messages matched by ErrIncorrectFlag, ErrMachineAlreadySpawned
+// and ErrCooldown. A release arena spawn which failed is answered with status 200.
+var apiMessages = []apiMessage{
+	{
+		target:  ErrIncorrectFlag,
+		status:  map[int]bool{http.StatusBadRequest: true},
+		pattern: regexp.MustCompile(`^(?i)incorrect flag!?$`),
+	},
+	{
+		target:  ErrMachineAlreadySpawned,
+		status:  map[int]bool{http.StatusOK: true, http.StatusBadRequest: true},
+		pattern: regexp.MustCompile(`^(?i)you have already spawned a machine\. terminate it first\.$`),
+	},
+	{
+		target:  ErrCooldown,
+		status:  map[int]bool{http.StatusBadRequest: true},
+		pattern: regexp.MustCompile(`^(?i)you must wait .+ before you can (reset|extend) this machine again\.$`),
+	},
+}
+
+// newAPIError will construct an APIError and extract the message field htb sends within the body
+func newAPIError(method, endpoint string, code int, body []byte) *APIError {
+	return &APIError{
+		StatusCode: code,
+		Method:     method,
+		Endpoint:   endpoint,
+		Message:    parseMessage(body),
+		Body:       body,
+	}
+}
+
+// checkResponse will return an APIError if code is not a 2xx or 3xx status code.
+// In that case the body will be read to fill the error details.
+func checkResponse(method, endpoint string, code int, body io.Reader) error {
+	if code < http.StatusBadRequest {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxErrorBodySize))
+	if err != nil {
+		return err
+	}
+
+	return newAPIError(method, endpoint, code, data)
+}
+
+// parseMessage will return the message field of a json body. If the field is not a
+// string its raw json is returned. Bodies which are no json yield an empty message.
+func parseMessage(body []byte) string {
+	var msg struct {
+		Message json.RawMessage `json:"message"`
+		Error   json.RawMessage `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return ""
+	}
+
+	raw := msg.Message
+	if len(raw) == 0 {
+		raw = msg.Error
+	}
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,66 @@
+package htbapi_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	sentinels := []error{
+		htbapi.ErrUnauthorized,
+		htbapi.ErrNotFound,
+		htbapi.ErrRateLimited,
+		htbapi.ErrIncorrectFlag,
+		htbapi.ErrMachineAlreadySpawned,
+		htbapi.ErrCooldown,
+	}
+
+	tests := []struct {
+		status  int
+		message string
+		// want is the only sentinel matching, nil for none
+		want error
+	}{
+		{http.StatusUnauthorized, "Unauthenticated.", htbapi.ErrUnauthorized},
+		{http.StatusNotFound, "Machine not found", htbapi.ErrNotFound},
+		{http.StatusTooManyRequests, "Too Many Attempts.", htbapi.ErrRateLimited},
+		{http.StatusBadRequest, "Incorrect Flag!", htbapi.ErrIncorrectFlag},
+		{http.StatusBadRequest, "incorrect flag", htbapi.ErrIncorrectFlag},
+		{http.StatusBadRequest, "You have already spawned a machine. Terminate it first.", htbapi.ErrMachineAlreadySpawned},
+		{http.StatusOK, "You have already spawned a machine. Terminate it first.", htbapi.ErrMachineAlreadySpawned},
+		{http.StatusBadRequest, "You must wait 4m0s before you can reset this machine again.", htbapi.ErrCooldown},
+		{http.StatusBadRequest, "You must wait 1 minute before you can extend this machine again.", htbapi.ErrCooldown},
+
+		// Messages which only share some words do not match
+		{http.StatusBadRequest, "A reset vote is already in progress.", nil},
+		{http.StatusBadRequest, "Your VPN connection is already active.", nil},
+		{http.StatusBadRequest, "Please wait a moment and try again.", nil},
+		{http.StatusBadRequest, "Flag is not incorrect flag", nil},
+		{http.StatusInternalServerError, "Service unavailable, please wait before trying again", nil},
+
+		// Known messages with an unexpected status do not match
+		{http.StatusInternalServerError, "Incorrect Flag!", nil},
+		{http.StatusNotFound, "You must wait 4m0s before you can reset this machine again.", htbapi.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d %s", tt.status, tt.message), func(t *testing.T) {
+			err := error(&htbapi.APIError{StatusCode: tt.status, Message: tt.message})
+			wrapped := fmt.Errorf("wrapped: %w", err)
+
+			for _, sentinel := range sentinels {
+				want := sentinel == tt.want
+				if got := errors.Is(err, sentinel); got != want {
+					t.Errorf("errors.Is(%v) = %v, want %v", sentinel, got, want)
+				}
+				if got := errors.Is(wrapped, sentinel); got != want {
+					t.Errorf("errors.Is(wrapped, %v) = %v, want %v", sentinel, got, want)
+				}
+			}
+		})
+	}
+}
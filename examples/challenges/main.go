@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,7 +17,7 @@ func main() {
 	}
 	cachePath := filepath.Join(home, ".htbapi", "session.cache")
 
-	a, err := htbapi.New("", "", true)
+	a, err := htbapi.New(htbapi.WithCredentials("", "", true))
 	if err != nil {
 		panic(err)
 	}
@@ -56,7 +57,7 @@ func main() {
 	// Query challenges and single challenge
 	/////////////////////////////////////////////////////////////////////////////
 
-	challenges, err := a.GetAllChallenges(false)
+	challenges, err := a.Challenges.List(context.Background(), false)
 	if err != nil {
 		panic(err)
 	}
@@ -65,7 +66,7 @@ func main() {
 		fmt.Printf("[%3d: ID %d] - %s\n", i+1, c.ID, c.Name)
 	}
 
-	gunship, err := a.GetChallenge(245)
+	gunship, err := a.Challenges.Get(context.Background(), 245)
 	if err != nil {
 		panic(err)
 	}
@@ -15,7 +15,7 @@ func main() {
 	}
 	cachePath := filepath.Join(home, ".htbapi", "session.cache")
 
-	a, err := htbapi.New("", "", true)
+	a, err := htbapi.New(htbapi.WithCredentials("", "", true))
 	if err != nil {
 		panic(err)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,7 +17,7 @@ func main() {
 	}
 	cachePath := filepath.Join(home, ".htbapi", "session.cache")
 
-	a, err := htbapi.New("", "", true)
+	a, err := htbapi.New(htbapi.WithCredentials("", "", true))
 	if err != nil {
 		panic(err)
 	}
@@ -56,7 +57,7 @@ func main() {
 	// Query machines and single machine
 	/////////////////////////////////////////////////////////////////////////////
 
-	machines, err := a.GetAllMachines(false)
+	machines, err := a.Machines.List(context.Background(), false)
 	if err != nil {
 		panic(err)
 	}
@@ -65,7 +66,7 @@ func main() {
 		fmt.Printf("[%d: ID %d] - %s\n", i+1, m.ID, m.Name)
 	}
 
-	devzat, err := a.GetMachine(398)
+	devzat, err := a.Machines.Get(context.Background(), 398)
 	if err != nil {
 		panic(err)
 	}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,7 +18,7 @@ func main() {
 	}
 	cachePath := filepath.Join(home, ".htbapi", "session.cache")
 
-	a, err := htbapi.New("", "", true)
+	a, err := htbapi.New(htbapi.WithCredentials("", "", true))
 	if err != nil {
 		panic(err)
 	}
@@ -56,20 +58,20 @@ func main() {
 	// Fetch running instance and submit flag (Lab environment)
 	/////////////////////////////////////////////////////////////////////////////
 
-	runningInstance, err := a.GetSpawnedMachineInstance(false)
+	runningInstance, err := a.Machines.Active(context.Background(), htbapi.Lab)
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Printf("The ip of the machine is '%s', spawned in lab: %s\n", runningInstance.IP, runningInstance.Server)
 
-	success, sr, err := runningInstance.Submit(a, "hereistheflag", 5, false)
-	if err != nil {
+	sr, err := a.Machines.Submit(context.Background(), runningInstance.Machine.ID, "hereistheflag", 5, htbapi.Lab)
+	if errors.Is(err, htbapi.ErrIncorrectFlag) {
+		fmt.Printf("Flag was not correct: %s\n", sr.Message)
+	} else if err != nil {
 		fmt.Printf("Error: %+v\n", err)
-	} else if success {
-		fmt.Printf("Flag was correct")
 	} else {
-		fmt.Printf("Flag was not correct: %s\n", sr.Message)
+		fmt.Printf("Flag was correct")
 	}
 
 	/////////////////////////////////////////////////////////////////////////////
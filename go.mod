@@ -1,7 +1,10 @@
 module github.com/patrickhener/go-htbapi
 
-go 1.17
+go 1.21
 
-require golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
+require (
+	golang.org/x/crypto v0.14.0
+	golang.org/x/term v0.13.0
+)
 
-require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
+require golang.org/x/sys v0.13.0 // indirect
@@ -3,26 +3,26 @@
 package htbapi
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/tls"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 // API represents the connection details with hackthebox
 // It will be provided with credentials and is the main interface to
 // communicate with the api at /api/v4
+// It is safe for concurrent use as long as the exported fields are not
+// modified while requests are running.
 type API struct {
 	BaseURL      string
 	Is2FAEnabled bool
@@ -33,6 +33,31 @@ type API struct {
 	Token        string
 	TokenHas2FA  bool
 	Username     string
+
+	// Services talking to the different parts of the api
+	Challenges *ChallengesService
+	Machines   *MachinesService
+	Rankings   *RankingsService
+	Users      *UsersService
+	VPN        *VPNService
+
+	cache        *responseCache
+	common       service
+	hooks        hooks
+	logger       *slog.Logger
+	middleware   []Middleware
+	mu           sync.RWMutex
+	otpProvider  OTPProvider
+	ownTransport *http.Transport
+	prompter     Prompter
+	rateLimiter  *RateLimiter
+	refreshMu    sync.Mutex
+	refreshSkew  time.Duration
+	refreshing   *refreshCall
+	retryPolicy  RetryPolicy
+	timeout      *time.Duration
+	tokenSource  TokenSource
+	userAgent    string
 }
 
 // LoginBody is used to construct the json payload for /login
@@ -66,6 +91,8 @@ type OTPLoginResponse struct {
 }
 
 // JWTPayload is used to construct the JWTToken data while parsed
+//
+// Deprecated: Use ParseToken and TokenClaims instead.
 type JWTPayload struct {
 	AUD string `json:"aud"`
 	JTI string `json:"jti"`
@@ -76,17 +103,24 @@ type JWTPayload struct {
 }
 
 // New will return an instantiated pointer to API.
-// BaseURL is set statically to "https://www.hackthebox.com/api/v4".
-// If DEBUG=TRUE is present in env http.Proxy will be set to http://127.0.0.1:8080.
-// Also the connection will then ignore self signed certificates.
-func New(u, p string, r bool) (*API, error) {
+// Without any options BaseURL is set to DefaultBaseURL and the http client
+// uses a timeout of 45 seconds. Use the Option functions to change that.
+func New(opts ...Option) (*API, error) {
 	a := &API{
-		BaseURL:  "https://www.hackthebox.com/api/v4",
-		Username: u,
-		Password: p,
-		Remember: r,
-		Session:  &http.Client{},
+		BaseURL:     DefaultBaseURL,
+		Session:     &http.Client{},
+		prompter:    &TerminalPrompter{},
+		refreshSkew: DefaultRefreshSkew,
+		retryPolicy: DefaultRetryPolicy(),
 	}
+	a.tokenSource = PasswordTokenSource(a)
+
+	a.common.api = a
+	a.Challenges = (*ChallengesService)(&a.common)
+	a.Machines = (*MachinesService)(&a.common)
+	a.Rankings = (*RankingsService)(&a.common)
+	a.Users = (*UsersService)(&a.common)
+	a.VPN = (*VPNService)(&a.common)
 
 	jar, err := cookiejar.New(&cookiejar.Options{})
 	if err != nil {
@@ -94,23 +128,20 @@ func New(u, p string, r bool) (*API, error) {
 	}
 	a.Session.Jar = jar
 	a.Session.Timeout = 45 * time.Second
-	a.Session.Transport = &http.Transport{
+	a.ownTransport = &http.Transport{
 		TLSHandshakeTimeout: 10 * time.Second,
 	}
+	a.Session.Transport = a.ownTransport
 
-	// Set proxy for http client if env DEBUG=TRUE
-	if os.Getenv("DEBUG") == "TRUE" {
-		proxy, err := url.Parse("http://127.0.0.1:8080")
-		if err != nil {
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
 			return nil, err
 		}
-		a.Session.Transport = &http.Transport{
-			Proxy: http.ProxyURL(proxy),
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			TLSHandshakeTimeout: 10 * time.Second,
-		}
+	}
+
+	// Applied last, so a client given by WithHTTPClient gets it as well
+	if a.timeout != nil {
+		a.Session.Timeout = *a.timeout
 	}
 
 	return a, nil
@@ -120,12 +151,17 @@ func New(u, p string, r bool) (*API, error) {
 // It will also trigger 2FA login if needed.
 // It is a wrapper function around DoLogin() and DoOTPLogin().
 func (a *API) Login() error {
-	if err := a.DoLogin(); err != nil {
+	return a.LoginContext(context.Background())
+}
+
+// LoginContext is like Login but uses ctx for all requests made.
+func (a *API) LoginContext(ctx context.Context) error {
+	if err := a.DoLoginContext(ctx); err != nil {
 		return err
 	}
 
-	if a.Is2FAEnabled {
-		if err := a.DoOTPLogin(); err != nil {
+	if a.sessionDetails().Is2FAEnabled {
+		if err := a.DoOTPLoginContext(ctx); err != nil {
 			return err
 		}
 	}
@@ -134,9 +170,14 @@ func (a *API) Login() error {
 }
 
 // DoLogin actually does the login request.
-// If Email and Password are not set, it will prompt for it.
+// If Email and Password are not set, it will ask the Prompter for it.
 // It sets the Session details within the API struct after successful login.
 func (a *API) DoLogin() error {
+	return a.DoLoginContext(context.Background())
+}
+
+// DoLoginContext is like DoLogin but uses ctx for the login request.
+func (a *API) DoLoginContext(ctx context.Context) error {
 	body := LoginBody{
 		Email:    a.Username,
 		Password: a.Password,
@@ -144,78 +185,72 @@ func (a *API) DoLogin() error {
 	}
 
 	if body.Email == "" {
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Enter email: ")
-		email, err := reader.ReadString('\n')
+		if a.prompter == nil {
+			return fmt.Errorf("%s", "no email set and no prompter to ask for it")
+		}
+
+		email, err := a.prompter.Email(ctx)
 		if err != nil {
 			return err
 		}
 
-		body.Email = strings.ReplaceAll(email, "\n", "")
+		body.Email = email
 	}
 
 	if body.Password == "" {
-		fmt.Print("Enter Password: ")
-		bytePassword, err := GetPasswdMasked()
+		if a.prompter == nil {
+			return fmt.Errorf("%s", "no password set and no prompter to ask for it")
+		}
+
+		password, err := a.prompter.Password(ctx)
 		if err != nil {
 			return err
 		}
 
-		body.Password = string(bytePassword)
-	}
-
-	jsonBody, err := json.Marshal(&body)
-	if err != nil {
-		return err
+		body.Password = password
 	}
 
-	resp, _, err := a.DoRequest("/login", jsonBody, false, true)
+	respMessage, err := doJSON[LoginResponse](ctx, a, http.MethodPost, "/login", body, false)
 	if err != nil {
 		return err
 	}
-	defer resp.Close()
 
-	var respMessage LoginResponse
-	if err := json.NewDecoder(resp).Decode(&respMessage); err != nil {
-		return err
-	}
-
-	a.Token = respMessage.Message.AccessToken
-	a.RefreshToken = respMessage.Message.RefreshToken
-	a.Is2FAEnabled = respMessage.Message.Is2FAEnabled
-	a.TokenHas2FA = respMessage.Message.TokenHas2FA
+	a.setCredentials(respMessage.Message)
 
 	return nil
 }
 
-// DoOTPLogin will handle the 2FA OTP login. It will prompt for the login code.
+// DoOTPLogin will handle the 2FA OTP login. The login code is taken from the
+// OTPProvider if set, otherwise the Prompter will ask for it.
 func (a *API) DoOTPLogin() error {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter OTP: ")
-	otp, err := reader.ReadString('\n')
-	if err != nil {
-		return err
-	}
-	otp = strings.Replace(otp, "\n", "", -1)
-	fmt.Println("")
+	return a.DoOTPLoginContext(context.Background())
+}
 
-	otpBody := OTPBody{
-		OneTimePassword: otp,
+// DoOTPLoginContext is like DoOTPLogin but uses ctx for the 2FA request.
+func (a *API) DoOTPLoginContext(ctx context.Context) error {
+	var otpProvider OTPProvider = a.prompter
+	if a.otpProvider != nil {
+		otpProvider = a.otpProvider
+	}
+	if otpProvider == nil {
+		return fmt.Errorf("%s", "no otp provider or prompter to get the otp from")
 	}
 
-	jsonOTPBody, err := json.Marshal(otpBody)
+	otp, err := otpProvider.OTP(ctx)
 	if err != nil {
 		return err
 	}
 
-	resp, _, err := a.DoRequest("/2fa/login", jsonOTPBody, true, true)
+	// The token of the first login step is needed, no matter which TokenSource is set
+	token, _ := a.credentials()
+
+	resp, err := a.send(ctx, a.NewRequest(http.MethodPost, "/2fa/login").JSON(OTPBody{OneTimePassword: otp}), token)
 	if err != nil {
 		return err
 	}
-	defer resp.Close()
 
-	var otpResp OTPLoginResponse
-	if err := json.NewDecoder(resp).Decode(&otpResp); err != nil {
+	otpResp, err := decodeResponse[OTPLoginResponse](resp, http.MethodPost, "/2fa/login")
+	if err != nil {
 		return err
 	}
 
@@ -229,64 +264,60 @@ func (a *API) DoOTPLogin() error {
 // DoRefreshToken will handle the renewal of the access_token. If it is expired
 // it will pull a new one using the refresh_token
 func (a *API) DoRefreshToken() error {
+	return a.DoRefreshTokenContext(context.Background())
+}
+
+// DoRefreshTokenContext is like DoRefreshToken but uses ctx for the refresh request.
+// It is safe to call it concurrently. Parallel calls will share one refresh request.
+func (a *API) DoRefreshTokenContext(ctx context.Context) error {
+	token, _ := a.credentials()
+
+	return a.refresh(ctx, token)
+}
+
+// doRefreshToken does the actual refresh request. It must only be called by refresh.
+func (a *API) doRefreshToken(ctx context.Context) error {
 	type refreshBody struct {
 		RefreshToken string `json:"refresh_token"`
 	}
 
+	token, refreshToken := a.credentials()
+
 	b := refreshBody{
-		RefreshToken: a.RefreshToken,
+		RefreshToken: refreshToken,
 	}
 
-	jsonBody, err := json.Marshal(&b)
+	// Send directly as going through the TokenSource would trigger another refresh
+	resp, err := a.send(ctx, a.NewRequest(http.MethodPost, "/login/refresh").JSON(b), token)
 	if err != nil {
 		return err
 	}
 
-	resp, _, err := a.DoRequest("/login/refresh", jsonBody, true, true)
+	respMessage, err := decodeResponse[LoginResponse](resp, http.MethodPost, "/login/refresh")
 	if err != nil {
 		return err
 	}
-	defer resp.Close()
-
-	var respMessage LoginResponse
-	if err := json.NewDecoder(resp).Decode(&respMessage); err != nil {
-		return err
-	}
 
 	if !respMessage.Message.TokenHas2FA {
 		return fmt.Errorf("%s", "missing otp, please do new login")
 	}
 
-	a.Token = respMessage.Message.AccessToken
-	a.RefreshToken = respMessage.Message.RefreshToken
-	a.Is2FAEnabled = respMessage.Message.Is2FAEnabled
-	a.TokenHas2FA = respMessage.Message.TokenHas2FA
+	a.setCredentials(respMessage.Message)
+	a.fireTokenRefresh()
 
 	return nil
 }
 
 // JWTExpired is a helper function. It will take the access_token and parse
 // the payload part of it. It will judge expiration based upon the 'exp' field
-// in the payload. It will compare it to time.Now().Unix()
+// in the payload. Use ParseToken to get all claims of the token.
 func JWTExpired(accessToken string) (bool, error) {
-	payloads := strings.Split(accessToken, ".")
-	data, err := base64.StdEncoding.DecodeString(payloads[1])
+	claims, err := ParseToken(accessToken)
 	if err != nil {
 		return false, err
 	}
 
-	var jwtPayload JWTPayload
-
-	if err := json.Unmarshal(data, &jwtPayload); err != nil {
-		return false, err
-	}
-
-	t := time.Now().Unix()
-	if t > jwtPayload.EXP {
-		return true, nil
-	} else {
-		return false, nil
-	}
+	return claims.Expired(), nil
 }
 
 // LoadSessionFromCache will load a session cache file containing
@@ -308,18 +339,16 @@ func (a *API) LoadSessionFromCache(path string) (bool, error) {
 		return false, err
 	}
 
-	expired, err := JWTExpired(sessionCache.AccessToken)
+	claims, err := ParseToken(sessionCache.AccessToken)
 	if err != nil {
 		return false, err
 	}
 
-	if expired {
+	if claims.Expired() {
 		return true, fmt.Errorf("%s", "cached session is expired. Please login again.")
 	}
 
-	a.Token = sessionCache.AccessToken
-	a.RefreshToken = sessionCache.RefreshToken
-	a.Is2FAEnabled = sessionCache.Is2FAEnabled
+	a.setCredentials(sessionCache)
 
 	return false, nil
 }
@@ -328,7 +357,8 @@ func (a *API) LoadSessionFromCache(path string) (bool, error) {
 // to disk to be read by LoadSessionFromCache. It will take a path
 // where the file will be written to.
 func (a *API) DumpSessionToCache(path string) error {
-	if a.Token == "" || a.RefreshToken == "" {
+	session := a.sessionDetails()
+	if session.AccessToken == "" || session.RefreshToken == "" {
 		return fmt.Errorf("%s", "there is no valid session yet")
 	}
 
@@ -340,9 +370,9 @@ func (a *API) DumpSessionToCache(path string) error {
 	}
 
 	sessionCache := LoginResponseMessage{
-		AccessToken:  a.Token,
-		RefreshToken: a.RefreshToken,
-		Is2FAEnabled: a.Is2FAEnabled,
+		AccessToken:  session.AccessToken,
+		RefreshToken: session.RefreshToken,
+		Is2FAEnabled: session.Is2FAEnabled,
 	}
 
 	file, err := json.MarshalIndent(sessionCache, "", "    ")
@@ -359,46 +389,77 @@ func (a *API) DumpSessionToCache(path string) error {
 
 // DoRequest will send a request to the API endpoint. You provide the endpoint, jsonData or nil, if it will be authorized by using the Bearer Token and if it is supposed to be a POST request (otherwise it will be GET).
 // It will return to you the io.ReadCloser of the responses body and the HTTP Status code.
+//
+// Deprecated: Use NewRequest which supports all http methods, query parameters and other bodies.
 func (a *API) DoRequest(endpoint string, jsonData []byte, authorized bool, post bool) (io.ReadCloser, int, error) {
-	var method string
+	return a.DoRequestContext(context.Background(), endpoint, jsonData, authorized, post)
+}
+
+// DoRequestContext is like DoRequest but sends the request with ctx.
+//
+// Deprecated: Use NewRequest which supports all http methods, query parameters and other bodies.
+func (a *API) DoRequestContext(ctx context.Context, endpoint string, jsonData []byte, authorized bool, post bool) (io.ReadCloser, int, error) {
+	method := http.MethodGet
 	if post {
-		method = "POST"
-	} else {
-		method = "GET"
+		method = http.MethodPost
+	}
+
+	r := a.NewRequest(method, endpoint)
+	if jsonData != nil {
+		r.RawBody(jsonData, "application/json")
+	}
+	if !authorized {
+		r.Unauthorized()
 	}
 
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", a.BaseURL, endpoint), bytes.NewBuffer(jsonData))
+	resp, err := r.Do(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
-	req.Header.Add("Accept", "application/json, text/plain, */*")
-	req.Header.Add("Origin", "https://app.hackthebox.com")
-	req.Header.Add("Referer", "https://app.hackthebox.com/")
 
-	if authorized {
-		expired, err := JWTExpired(a.Token)
-		if err != nil {
-			return nil, 0, err
+	return resp.Body, resp.StatusCode, nil
+}
 
-		}
+// send will send the request and retry it according to the RetryPolicy.
+// Every attempt has to pass the RateLimiter if one is set.
+// If token is not empty it will be used as Bearer Token.
+func (a *API) send(ctx context.Context, r *Request, token string) (*http.Response, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	doer := a.chain()
 
-		if expired {
-			if err := a.DoRefreshToken(); err != nil {
-				return nil, 0, err
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		if a.rateLimiter != nil {
+			if err := a.rateLimiter.Wait(ctx, r.endpoint); err != nil {
+				return nil, err
 			}
 		}
 
-		req.Header.Add("Authorization", "Bearer "+a.Token)
-	}
+		req, err := r.httpRequest(ctx, token)
+		if err != nil {
+			return nil, err
+		}
 
-	if jsonData != nil {
-		req.Header.Add("Content-Type", "application/json")
-	}
+		resp, err := doer.Do(req)
 
-	resp, err := a.Session.Do(req)
-	if err != nil {
-		return nil, 0, err
-	}
+		retry, wait := a.retryPolicy.shouldRetry(ctx, attempt, r.method, r.endpoint, resp, err)
+		if !retry {
+			a.logRequest(ctx, r, attempt, start, resp, err)
+			return resp, err
+		}
+		a.logRetry(ctx, r, attempt, wait, resp, err)
+		a.fireRetry(r.method, r.endpoint, attempt, wait)
 
-	return resp.Body, resp.StatusCode, nil
+		if resp != nil {
+			drainBody(resp.Body)
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
 }
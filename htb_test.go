@@ -0,0 +1,199 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	claims, err := a.TokenInfo()
+	if err != nil {
+		t.Fatalf("TokenInfo: %v", err)
+	}
+	if claims.ExpiresIn() <= 0 {
+		t.Errorf("token expires in %s", claims.ExpiresIn())
+	}
+
+	info, err := a.Users.Info(context.Background())
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Email != htbtest.DefaultEmail {
+		t.Errorf("email = %q", info.Email)
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	s := newTestServer(t)
+	a := newTestAPI(t, s, htbapi.WithCredentials(htbtest.DefaultEmail, "wrong", false))
+
+	if err := a.Login(); !errors.Is(err, htbapi.ErrUnauthorized) {
+		t.Fatalf("err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestLogin2FA(t *testing.T) {
+	s := newTestServer(t)
+	s.Enable2FA("123456")
+
+	a := newTestAPI(t, s, htbapi.WithOTPProvider(&countingPrompter{otp: "123456"}))
+	login(t, a)
+
+	if _, err := a.Users.Info(context.Background()); err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if n := s.RequestCount(http.MethodPost, "/2fa/login"); n != 1 {
+		t.Errorf("%d 2fa requests, want 1", n)
+	}
+}
+
+func TestLogin2FAWrongOTP(t *testing.T) {
+	s := newTestServer(t)
+	s.Enable2FA("123456")
+
+	a := newTestAPI(t, s, htbapi.WithOTPProvider(&countingPrompter{otp: "000000"}))
+	if err := a.Login(); err == nil {
+		t.Fatal("login with a wrong otp succeeded")
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	s := newTestServer(t)
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	before := a.Token
+	if err := a.DoRefreshToken(); err != nil {
+		t.Fatalf("DoRefreshToken: %v", err)
+	}
+	if a.Token == before {
+		t.Error("access_token was not replaced")
+	}
+
+	// The refresh_token is single use, so the session must carry the new one
+	if err := a.DoRefreshToken(); err != nil {
+		t.Fatalf("second DoRefreshToken: %v", err)
+	}
+}
+
+func TestSpawnActiveStop(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newTestAPI(t, s)
+	login(t, a)
+	ctx := context.Background()
+
+	if _, err := a.Machines.Spawn(ctx, 1, htbapi.Lab); err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+	if _, err := a.Machines.Spawn(ctx, 1, htbapi.Lab); !errors.Is(err, htbapi.ErrMachineAlreadySpawned) {
+		t.Errorf("second Spawn: %v, want ErrMachineAlreadySpawned", err)
+	}
+
+	mi, err := a.Machines.Active(ctx, htbapi.Lab)
+	if err != nil {
+		t.Fatalf("Active: %v", err)
+	}
+	if mi.Machine.ID != 1 || mi.IP == "" {
+		t.Errorf("active machine = %d at %q", mi.Machine.ID, mi.IP)
+	}
+
+	if err := a.Machines.Stop(ctx, 1, htbapi.Lab); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if _, ok := s.Spawned("lab"); ok {
+		t.Error("machine still spawned")
+	}
+}
+
+func TestSubmitMachineFlags(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newTestAPI(t, s)
+	login(t, a)
+	ctx := context.Background()
+
+	if _, err := a.Machines.Spawn(ctx, 1, htbapi.Lab); err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+
+	if _, err := a.Machines.Submit(ctx, 1, "wrong", 5, htbapi.Lab); !errors.Is(err, htbapi.ErrIncorrectFlag) {
+		t.Errorf("wrong flag: %v, want ErrIncorrectFlag", err)
+	}
+	for _, flag := range []string{"user", "root"} {
+		if _, err := a.Machines.Submit(ctx, 1, flag, 5, htbapi.Lab); err != nil {
+			t.Errorf("Submit %s: %v", flag, err)
+		}
+	}
+	if user, root := s.Owns(1); !user || !root {
+		t.Errorf("owns user=%v root=%v", user, root)
+	}
+
+	if _, err := a.Machines.Submit(ctx, 1, "user", 11, htbapi.Lab); err == nil {
+		t.Error("difficulty 11 was accepted")
+	}
+}
+
+func TestSubmitChallengeFlag(t *testing.T) {
+	s := newTestServer(t)
+	s.AddChallenge(htbapi.Challenge{ID: 7, Name: "Weak RSA"}, "flag")
+	a := newTestAPI(t, s)
+	login(t, a)
+	ctx := context.Background()
+
+	if _, err := a.Challenges.Submit(ctx, 7, "wrong", 5); !errors.Is(err, htbapi.ErrIncorrectFlag) {
+		t.Errorf("wrong flag: %v, want ErrIncorrectFlag", err)
+	}
+
+	// The api sometimes reports a wrong flag with status 200
+	s.InjectFault(htbtest.Fault{
+		PathPrefix: "/challenge/own",
+		Status:     http.StatusOK,
+		Body:       `{"status":400,"message":"Incorrect Flag!"}`,
+		Times:      1,
+	})
+	if _, err := a.Challenges.Submit(ctx, 7, "wrong", 5); !errors.Is(err, htbapi.ErrIncorrectFlag) {
+		t.Errorf("wrong flag with status 200: %v, want ErrIncorrectFlag", err)
+	}
+
+	if _, err := a.Challenges.Submit(ctx, 7, "flag", 5); err != nil {
+		t.Errorf("Submit: %v", err)
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	s.InjectFault(htbtest.Fault{Method: http.MethodGet, PathPrefix: "/machine/profile", Status: http.StatusBadGateway})
+	_, err := a.Machines.Get(context.Background(), 1)
+	var apiErr *htbapi.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("err = %v, want a 502 APIError", err)
+	}
+
+	s.ClearFaults()
+	s.InjectFault(htbtest.Fault{PathPrefix: "/machine/profile", Delay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := a.Machines.Get(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	s.ClearFaults()
+	if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+		t.Fatalf("Get after ClearFaults: %v", err)
+	}
+}
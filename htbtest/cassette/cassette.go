@@ -0,0 +1,359 @@
+// Package cassette provides a http.RoundTripper recording real api sessions to
+// a file and replaying them in offline tests. Secrets like passwords, tokens,
+// submitted flags and the account email are scrubbed from bodies and query strings
+// before the interactions are written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNoMatch is returned in replay mode if no recorded interaction matches a request
+var ErrNoMatch = errors.New("cassette: no matching interaction")
+
+// Redacted replaces scrubbed secrets
+const Redacted = "REDACTED"
+
+// Mode decides if the Recorder records or replays
+type Mode int
+
+const (
+	// ModeReplay serves recorded interactions and fails on unmatched requests
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real server and records them
+	ModeRecord
+)
+
+// Cassette is the file format holding all interactions
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// Response is a recorded response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Matcher reports whether the live request r with its scrubbed body matches the recorded request
+type Matcher func(r *http.Request, body string, recorded Request) bool
+
+// DefaultMatcher matches method, url and body
+func DefaultMatcher(r *http.Request, body string, recorded Request) bool {
+	return r.Method == recorded.Method && r.URL.String() == recorded.URL && body == recorded.Body
+}
+
+// MethodURLMatcher matches method and url only
+func MethodURLMatcher(r *http.Request, body string, recorded Request) bool {
+	return r.Method == recorded.Method && r.URL.String() == recorded.URL
+}
+
+// Option configures a Recorder
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to send requests in record mode.
+// It defaults to http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithMatcher sets the Matcher used in replay mode. It defaults to DefaultMatcher.
+func WithMatcher(m Matcher) Option {
+	return func(r *Recorder) {
+		r.matcher = m
+	}
+}
+
+// WithScrubHeaders adds headers whose values will be scrubbed
+func WithScrubHeaders(headers ...string) Option {
+	return func(r *Recorder) {
+		r.scrubHeaders = append(r.scrubHeaders, headers...)
+	}
+}
+
+// WithScrubFields adds json fields and query parameters whose values will be scrubbed
+// in request urls and in request and response bodies
+func WithScrubFields(fields ...string) Option {
+	return func(r *Recorder) {
+		for _, f := range fields {
+			r.scrubFields[f] = Redacted
+		}
+	}
+}
+
+// Recorder is a http.RoundTripper recording or replaying interactions.
+// Set it as Transport of htbapi.API.Session.
+type Recorder struct {
+	path         string
+	mode         Mode
+	transport    http.RoundTripper
+	matcher      Matcher
+	scrubHeaders []string
+	scrubFields  map[string]string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New returns a Recorder for the cassette at path. In replay mode the cassette is
+// loaded right away. In record mode it is written by Save.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:         path,
+		mode:         mode,
+		transport:    http.DefaultTransport,
+		matcher:      DefaultMatcher,
+		scrubHeaders: []string{"Authorization", "Cookie", "Set-Cookie"},
+		scrubFields: map[string]string{
+			"password":          Redacted,
+			"one_time_password": Redacted,
+			"access_token":      redactedToken,
+			"refresh_token":     Redacted,
+			"token":             Redacted,
+			"flag":              Redacted,
+			"email":             Redacted,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("cassette: cannot read %s: %+v", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper. The body of req is consumed, the request
+// sent or matched is a clone of it.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req = req.Clone(req.Context())
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+
+	return r.replay(req, body)
+}
+
+// Save writes all recorded interactions to the cassette file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.cassette, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, data, 0600)
+}
+
+// record sends the request and stores the scrubbed interaction
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.scrubURL(req.URL).String(),
+			Header: r.scrubHeader(req.Header),
+			Body:   r.scrubBody(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.scrubHeader(resp.Header),
+			Body:       r.scrubBody(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// replay serves the first unused interaction matching the request
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	scrubbed := r.scrubBody(body)
+
+	// Recorded urls are scrubbed, so the live one is matched scrubbed as well
+	match := req.Clone(req.Context())
+	match.URL = r.scrubURL(req.URL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matcher(match, scrubbed, interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, req.Method, req.URL)
+}
+
+// scrubHeader returns a copy of h with all secret headers replaced
+func (r *Recorder) scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.scrubHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, Redacted)
+		}
+	}
+
+	return h
+}
+
+// scrubURL returns a copy of u with the values of all secret query parameters replaced
+func (r *Recorder) scrubURL(u *url.URL) *url.URL {
+	c := *u
+	if u.RawQuery == "" {
+		return &c
+	}
+
+	q := u.Query()
+	scrubbed := false
+	for k := range q {
+		if replacement, ok := r.scrubFields[k]; ok {
+			q.Set(k, replacement)
+			scrubbed = true
+		}
+	}
+	if scrubbed {
+		c.RawQuery = q.Encode()
+	}
+
+	return &c
+}
+
+// scrubBody replaces the values of all secret fields in a json body.
+// Bodies which are no json are returned unchanged.
+func (r *Recorder) scrubBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+
+	data, err := json.Marshal(r.scrubValue(v))
+	if err != nil {
+		return string(body)
+	}
+
+	return string(data)
+}
+
+// scrubValue walks v and replaces the secret fields of all objects
+func (r *Recorder) scrubValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if replacement, ok := r.scrubFields[k]; ok {
+				t[k] = replacement
+				continue
+			}
+			t[k] = r.scrubValue(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = r.scrubValue(val)
+		}
+	}
+
+	return v
+}
+
+// redactedToken replaces access tokens. It is a JWT expiring in 2100 so clients
+// replaying a cassette can still parse it and will not try to refresh it.
+var redactedToken = strings.Join([]string{
+	base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"none"}`)),
+	base64.RawURLEncoding.EncodeToString([]byte(`{"exp":4102444800,"sub":"` + Redacted + `"}`)),
+	Redacted,
+}, ".")
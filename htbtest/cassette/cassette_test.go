@@ -0,0 +1,146 @@
+package cassette_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+	"github.com/patrickhener/go-htbapi/htbtest/cassette"
+)
+
+const (
+	password    = "s3cret-pass"
+	userFlag    = "HTB{user-flag}"
+	querySecret = "query-secret"
+)
+
+// newAPI returns an API sending all requests through rec
+func newAPI(t *testing.T, baseURL string, rec *cassette.Recorder) *htbapi.API {
+	t.Helper()
+
+	a, err := htbapi.New(
+		htbapi.WithBaseURL(baseURL),
+		htbapi.WithCredentials(htbtest.DefaultEmail, password, false),
+		htbapi.WithHTTPClient(&http.Client{Transport: rec}),
+		htbapi.WithRetryPolicy(htbapi.RetryPolicy{MaxAttempts: 1}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	return a
+}
+
+// session runs the same calls while recording and replaying
+func session(t *testing.T, a *htbapi.API) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := a.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	info, err := a.Users.Info(ctx)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.ID == 0 {
+		t.Errorf("Info = %+v, want an account", info)
+	}
+
+	m, err := a.Machines.Get(ctx, 1)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if m.Name != "Lame" {
+		t.Errorf("Get name = %q, want Lame", m.Name)
+	}
+
+	if _, err := a.Machines.Spawn(ctx, 1, htbapi.Lab); err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+
+	if _, err := a.Machines.Submit(ctx, 1, userFlag, 5, htbapi.Lab); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	resp, err := a.NewRequest(http.MethodGet, "/machine/profile/1").Query("token", querySecret).Do(ctx)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	s := htbtest.NewServer()
+	s.SetCredentials(htbtest.DefaultEmail, password)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, userFlag, "HTB{root-flag}")
+
+	rec, err := cassette.New(path, cassette.ModeRecord)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a := newAPI(t, s.BaseURL(), rec)
+	session(t, a)
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	token := a.Token
+	baseURL := s.BaseURL()
+	s.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{htbtest.DefaultEmail, password, userFlag, querySecret, token} {
+		if secret != "" && bytes.Contains(data, []byte(secret)) {
+			t.Errorf("cassette contains secret %q", secret)
+		}
+	}
+	if !bytes.Contains(data, []byte("token="+cassette.Redacted)) {
+		t.Errorf("cassette does not contain the redacted query parameter:\n%s", data)
+	}
+
+	// The server is closed, so everything has to come from the cassette
+	rec, err = cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	session(t, newAPI(t, baseURL, rec))
+}
+
+func TestReplayNoMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.json")
+	if err := ioutil.WriteFile(path, []byte(`{"interactions":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/login", strings.NewReader(`{"email":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := req.Body
+
+	_, err = rec.RoundTrip(req)
+	if !errors.Is(err, cassette.ErrNoMatch) {
+		t.Errorf("RoundTrip error = %v, want ErrNoMatch", err)
+	}
+	if req.Body != body {
+		t.Error("RoundTrip replaced the body of the caller's request")
+	}
+}
@@ -0,0 +1,447 @@
+package htbtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+// ErrNotMocked is returned by the mocks for methods without a func set
+var ErrNotMocked = errors.New("htbtest: method not mocked")
+
+// callLog records the calls of a mock
+type callLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// Calls returns the names of all called methods in order
+func (c *callLog) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.names...)
+}
+
+// CallCount returns how often the method name was called
+func (c *callLog) CallCount(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, call := range c.names {
+		if call == name {
+			n++
+		}
+	}
+
+	return n
+}
+
+// record adds a call of name
+func (c *callLog) record(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.names = append(c.names, name)
+}
+
+// notMocked returns an iterator failing with ErrNotMocked
+func notMocked[T any](ctx context.Context) *htbapi.Iterator[T] {
+	return htbapi.NewIterator(ctx, func(ctx context.Context, page int) (htbapi.Page[T], error) {
+		return htbapi.Page[T]{}, ErrNotMocked
+	})
+}
+
+// MockClient implements htbapi.Client with a mock per service. The zero value is
+// ready to use, set the funcs of the services a test needs:
+//
+//	c := &htbtest.MockClient{}
+//	c.Machines.GetFunc = func(ctx context.Context, id int) (htbapi.Machine, error) {
+//		return htbapi.Machine{ID: id, Name: "Lame"}, nil
+//	}
+type MockClient struct {
+	Machines   MockMachines
+	Challenges MockChallenges
+	VPN        MockVPN
+	Users      MockUsers
+	Rankings   MockRankings
+}
+
+var _ htbapi.Client = (*MockClient)(nil)
+
+// MachineClient implements htbapi.Client
+func (c *MockClient) MachineClient() htbapi.MachineClient {
+	return &c.Machines
+}
+
+// ChallengeClient implements htbapi.Client
+func (c *MockClient) ChallengeClient() htbapi.ChallengeClient {
+	return &c.Challenges
+}
+
+// VPNClient implements htbapi.Client
+func (c *MockClient) VPNClient() htbapi.VPNClient {
+	return &c.VPN
+}
+
+// UserClient implements htbapi.Client
+func (c *MockClient) UserClient() htbapi.UserClient {
+	return &c.Users
+}
+
+// RankingClient implements htbapi.Client
+func (c *MockClient) RankingClient() htbapi.RankingClient {
+	return &c.Rankings
+}
+
+// MockMachines implements htbapi.MachineClient with a func field per method, so tests
+// of code depending on the interface can stub single calls without a server:
+//
+//	m := &htbtest.MockMachines{
+//		GetFunc: func(ctx context.Context, id int) (htbapi.Machine, error) {
+//			return htbapi.Machine{ID: id, Name: "Lame"}, nil
+//		},
+//	}
+//
+// Methods whose func is nil return ErrNotMocked, iterators fail with it. All calls
+// are recorded by name.
+// The other mocks of this package work the same way.
+type MockMachines struct {
+	ListFunc         func(ctx context.Context, retired bool) ([]htbapi.Machine, error)
+	GetFunc          func(ctx context.Context, id int) (htbapi.Machine, error)
+	QueryFunc        func(ctx context.Context, q htbapi.MachineQuery) *htbapi.Iterator[htbapi.Machine]
+	ReleaseArenaFunc func(ctx context.Context) (htbapi.Machine, error)
+	ActiveFunc       func(ctx context.Context, arena htbapi.Arena) (htbapi.MachineInstance, error)
+	SpawnFunc        func(ctx context.Context, id int, arena htbapi.Arena) (htbapi.MachineInstance, error)
+	SpawnAndWaitFunc func(ctx context.Context, id int, arena htbapi.Arena, opts htbapi.WaitOptions) (htbapi.MachineInstance, error)
+	WaitReadyFunc    func(ctx context.Context, arena htbapi.Arena, opts htbapi.WaitOptions) (htbapi.MachineInstance, error)
+	StopFunc         func(ctx context.Context, id int, arena htbapi.Arena) error
+	SubmitFunc       func(ctx context.Context, id int, flag string, difficulty int, arena htbapi.Arena) (htbapi.SubmissionResponse, error)
+	ResetFunc        func(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error)
+	ExtendFunc       func(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error)
+	VoteResetFunc    func(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error)
+	AcceptVoteFunc   func(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error)
+
+	callLog
+}
+
+var _ htbapi.MachineClient = (*MockMachines)(nil)
+
+// List implements htbapi.MachineClient
+func (m *MockMachines) List(ctx context.Context, retired bool) ([]htbapi.Machine, error) {
+	m.record("List")
+	if m.ListFunc == nil {
+		return nil, ErrNotMocked
+	}
+
+	return m.ListFunc(ctx, retired)
+}
+
+// Get implements htbapi.MachineClient
+func (m *MockMachines) Get(ctx context.Context, id int) (htbapi.Machine, error) {
+	m.record("Get")
+	if m.GetFunc == nil {
+		return htbapi.Machine{}, ErrNotMocked
+	}
+
+	return m.GetFunc(ctx, id)
+}
+
+// Query implements htbapi.MachineClient
+func (m *MockMachines) Query(ctx context.Context, q htbapi.MachineQuery) *htbapi.Iterator[htbapi.Machine] {
+	m.record("Query")
+	if m.QueryFunc == nil {
+		return notMocked[htbapi.Machine](ctx)
+	}
+
+	return m.QueryFunc(ctx, q)
+}
+
+// ReleaseArena implements htbapi.MachineClient
+func (m *MockMachines) ReleaseArena(ctx context.Context) (htbapi.Machine, error) {
+	m.record("ReleaseArena")
+	if m.ReleaseArenaFunc == nil {
+		return htbapi.Machine{}, ErrNotMocked
+	}
+
+	return m.ReleaseArenaFunc(ctx)
+}
+
+// Active implements htbapi.MachineClient
+func (m *MockMachines) Active(ctx context.Context, arena htbapi.Arena) (htbapi.MachineInstance, error) {
+	m.record("Active")
+	if m.ActiveFunc == nil {
+		return htbapi.MachineInstance{}, ErrNotMocked
+	}
+
+	return m.ActiveFunc(ctx, arena)
+}
+
+// Spawn implements htbapi.MachineClient
+func (m *MockMachines) Spawn(ctx context.Context, id int, arena htbapi.Arena) (htbapi.MachineInstance, error) {
+	m.record("Spawn")
+	if m.SpawnFunc == nil {
+		return htbapi.MachineInstance{}, ErrNotMocked
+	}
+
+	return m.SpawnFunc(ctx, id, arena)
+}
+
+// SpawnAndWait implements htbapi.MachineClient
+func (m *MockMachines) SpawnAndWait(ctx context.Context, id int, arena htbapi.Arena, opts htbapi.WaitOptions) (htbapi.MachineInstance, error) {
+	m.record("SpawnAndWait")
+	if m.SpawnAndWaitFunc == nil {
+		return htbapi.MachineInstance{}, ErrNotMocked
+	}
+
+	return m.SpawnAndWaitFunc(ctx, id, arena, opts)
+}
+
+// WaitReady implements htbapi.MachineClient
+func (m *MockMachines) WaitReady(ctx context.Context, arena htbapi.Arena, opts htbapi.WaitOptions) (htbapi.MachineInstance, error) {
+	m.record("WaitReady")
+	if m.WaitReadyFunc == nil {
+		return htbapi.MachineInstance{}, ErrNotMocked
+	}
+
+	return m.WaitReadyFunc(ctx, arena, opts)
+}
+
+// Stop implements htbapi.MachineClient
+func (m *MockMachines) Stop(ctx context.Context, id int, arena htbapi.Arena) error {
+	m.record("Stop")
+	if m.StopFunc == nil {
+		return ErrNotMocked
+	}
+
+	return m.StopFunc(ctx, id, arena)
+}
+
+// Submit implements htbapi.MachineClient
+func (m *MockMachines) Submit(ctx context.Context, id int, flag string, difficulty int, arena htbapi.Arena) (htbapi.SubmissionResponse, error) {
+	m.record("Submit")
+	if m.SubmitFunc == nil {
+		return htbapi.SubmissionResponse{}, ErrNotMocked
+	}
+
+	return m.SubmitFunc(ctx, id, flag, difficulty, arena)
+}
+
+// Reset implements htbapi.MachineClient
+func (m *MockMachines) Reset(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error) {
+	m.record("Reset")
+	if m.ResetFunc == nil {
+		return htbapi.LifecycleResult{}, ErrNotMocked
+	}
+
+	return m.ResetFunc(ctx, id, arena)
+}
+
+// Extend implements htbapi.MachineClient
+func (m *MockMachines) Extend(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error) {
+	m.record("Extend")
+	if m.ExtendFunc == nil {
+		return htbapi.LifecycleResult{}, ErrNotMocked
+	}
+
+	return m.ExtendFunc(ctx, id, arena)
+}
+
+// VoteReset implements htbapi.MachineClient
+func (m *MockMachines) VoteReset(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error) {
+	m.record("VoteReset")
+	if m.VoteResetFunc == nil {
+		return htbapi.LifecycleResult{}, ErrNotMocked
+	}
+
+	return m.VoteResetFunc(ctx, id, arena)
+}
+
+// AcceptResetVote implements htbapi.MachineClient
+func (m *MockMachines) AcceptResetVote(ctx context.Context, id int, arena htbapi.Arena) (htbapi.LifecycleResult, error) {
+	m.record("AcceptResetVote")
+	if m.AcceptVoteFunc == nil {
+		return htbapi.LifecycleResult{}, ErrNotMocked
+	}
+
+	return m.AcceptVoteFunc(ctx, id, arena)
+}
+
+// MockChallenges implements htbapi.ChallengeClient, see MockMachines
+type MockChallenges struct {
+	ListFunc     func(ctx context.Context, retired bool) ([]htbapi.Challenge, error)
+	GetFunc      func(ctx context.Context, id int) (htbapi.Challenge, error)
+	IterFunc     func(ctx context.Context, retired bool) *htbapi.Iterator[htbapi.Challenge]
+	DownloadFunc func(ctx context.Context, id int, w io.Writer) (int64, error)
+	SubmitFunc   func(ctx context.Context, id int, flag string, difficulty int) (htbapi.SubmissionResponse, error)
+
+	callLog
+}
+
+var _ htbapi.ChallengeClient = (*MockChallenges)(nil)
+
+// List implements htbapi.ChallengeClient
+func (m *MockChallenges) List(ctx context.Context, retired bool) ([]htbapi.Challenge, error) {
+	m.record("List")
+	if m.ListFunc == nil {
+		return nil, ErrNotMocked
+	}
+
+	return m.ListFunc(ctx, retired)
+}
+
+// Get implements htbapi.ChallengeClient
+func (m *MockChallenges) Get(ctx context.Context, id int) (htbapi.Challenge, error) {
+	m.record("Get")
+	if m.GetFunc == nil {
+		return htbapi.Challenge{}, ErrNotMocked
+	}
+
+	return m.GetFunc(ctx, id)
+}
+
+// Iter implements htbapi.ChallengeClient
+func (m *MockChallenges) Iter(ctx context.Context, retired bool) *htbapi.Iterator[htbapi.Challenge] {
+	m.record("Iter")
+	if m.IterFunc == nil {
+		return notMocked[htbapi.Challenge](ctx)
+	}
+
+	return m.IterFunc(ctx, retired)
+}
+
+// Download implements htbapi.ChallengeClient
+func (m *MockChallenges) Download(ctx context.Context, id int, w io.Writer) (int64, error) {
+	m.record("Download")
+	if m.DownloadFunc == nil {
+		return 0, ErrNotMocked
+	}
+
+	return m.DownloadFunc(ctx, id, w)
+}
+
+// Submit implements htbapi.ChallengeClient
+func (m *MockChallenges) Submit(ctx context.Context, id int, flag string, difficulty int) (htbapi.SubmissionResponse, error) {
+	m.record("Submit")
+	if m.SubmitFunc == nil {
+		return htbapi.SubmissionResponse{}, ErrNotMocked
+	}
+
+	return m.SubmitFunc(ctx, id, flag, difficulty)
+}
+
+// MockVPN implements htbapi.VPNClient, see MockMachines
+type MockVPN struct {
+	ServersFunc func(ctx context.Context) (map[string]htbapi.VPNServer, error)
+	CurrentFunc func(ctx context.Context, search string) (htbapi.VPNServer, error)
+
+	callLog
+}
+
+var _ htbapi.VPNClient = (*MockVPN)(nil)
+
+// Servers implements htbapi.VPNClient
+func (m *MockVPN) Servers(ctx context.Context) (map[string]htbapi.VPNServer, error) {
+	m.record("Servers")
+	if m.ServersFunc == nil {
+		return nil, ErrNotMocked
+	}
+
+	return m.ServersFunc(ctx)
+}
+
+// Current implements htbapi.VPNClient
+func (m *MockVPN) Current(ctx context.Context, search string) (htbapi.VPNServer, error) {
+	m.record("Current")
+	if m.CurrentFunc == nil {
+		return htbapi.VPNServer{}, ErrNotMocked
+	}
+
+	return m.CurrentFunc(ctx, search)
+}
+
+// MockUsers implements htbapi.UserClient, see MockMachines
+type MockUsers struct {
+	InfoFunc     func(ctx context.Context) (htbapi.UserInfo, error)
+	ProfileFunc  func(ctx context.Context, id int) (htbapi.UserProfile, error)
+	ActivityFunc func(ctx context.Context, id int) *htbapi.Iterator[htbapi.UserActivity]
+
+	callLog
+}
+
+var _ htbapi.UserClient = (*MockUsers)(nil)
+
+// Info implements htbapi.UserClient
+func (m *MockUsers) Info(ctx context.Context) (htbapi.UserInfo, error) {
+	m.record("Info")
+	if m.InfoFunc == nil {
+		return htbapi.UserInfo{}, ErrNotMocked
+	}
+
+	return m.InfoFunc(ctx)
+}
+
+// Profile implements htbapi.UserClient
+func (m *MockUsers) Profile(ctx context.Context, id int) (htbapi.UserProfile, error) {
+	m.record("Profile")
+	if m.ProfileFunc == nil {
+		return htbapi.UserProfile{}, ErrNotMocked
+	}
+
+	return m.ProfileFunc(ctx, id)
+}
+
+// Activity implements htbapi.UserClient
+func (m *MockUsers) Activity(ctx context.Context, id int) *htbapi.Iterator[htbapi.UserActivity] {
+	m.record("Activity")
+	if m.ActivityFunc == nil {
+		return notMocked[htbapi.UserActivity](ctx)
+	}
+
+	return m.ActivityFunc(ctx, id)
+}
+
+// MockRankings implements htbapi.RankingClient, see MockMachines
+type MockRankings struct {
+	UsersFunc     func(ctx context.Context) *htbapi.Iterator[htbapi.Ranking]
+	TeamsFunc     func(ctx context.Context) *htbapi.Iterator[htbapi.Ranking]
+	CountriesFunc func(ctx context.Context) *htbapi.Iterator[htbapi.Ranking]
+
+	callLog
+}
+
+var _ htbapi.RankingClient = (*MockRankings)(nil)
+
+// Users implements htbapi.RankingClient
+func (m *MockRankings) Users(ctx context.Context) *htbapi.Iterator[htbapi.Ranking] {
+	m.record("Users")
+	if m.UsersFunc == nil {
+		return notMocked[htbapi.Ranking](ctx)
+	}
+
+	return m.UsersFunc(ctx)
+}
+
+// Teams implements htbapi.RankingClient
+func (m *MockRankings) Teams(ctx context.Context) *htbapi.Iterator[htbapi.Ranking] {
+	m.record("Teams")
+	if m.TeamsFunc == nil {
+		return notMocked[htbapi.Ranking](ctx)
+	}
+
+	return m.TeamsFunc(ctx)
+}
+
+// Countries implements htbapi.RankingClient
+func (m *MockRankings) Countries(ctx context.Context) *htbapi.Iterator[htbapi.Ranking] {
+	m.record("Countries")
+	if m.CountriesFunc == nil {
+		return notMocked[htbapi.Ranking](ctx)
+	}
+
+	return m.CountriesFunc(ctx)
+}
@@ -0,0 +1,1190 @@
+// Package htbtest provides an in-process fake of the hackthebox api/v4 endpoint.
+// It keeps all state in memory and is meant to be used in tests of htbapi and
+// of tools built upon it.
+package htbtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+const (
+	// machineLifetime is how long a machine runs after spawning and is extended by
+	machineLifetime = 24 * time.Hour
+	// expiryLayout is the format of expires_at
+	expiryLayout = "2006-01-02 15:04:05"
+)
+
+const (
+	// APIPrefix is the path prefix all endpoints are served under
+	APIPrefix = "/api/v4"
+	// DefaultEmail is the email of the account the server starts with
+	DefaultEmail = "player@example.com"
+	// DefaultPassword is the password of the account the server starts with
+	DefaultPassword = "password"
+	// DefaultTokenTTL is the lifetime of issued access tokens
+	DefaultTokenTTL = time.Hour
+	// DefaultUserID is the id of the account the server starts with
+	DefaultUserID = 1
+	// DefaultUsername is the name of the account the server starts with
+	DefaultUsername = "player"
+)
+
+// Server is a fake hackthebox api. Use BaseURL as base url of the API under test.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	email         string
+	password      string
+	otp           string
+	tokenTTL      time.Duration
+	spawnDelay    time.Duration
+	cooldown      time.Duration
+	tokens        map[string]*session
+	refreshTokens map[string]bool
+	machines      []*machineState
+	challenges    []*challengeState
+	user          htbapi.UserInfo
+	activity      []htbapi.UserActivity
+	rankings      map[string][]htbapi.Ranking
+	active        map[string]*activeMachine
+	releaseArena  int
+	faults        []*Fault
+	requests      []Request
+}
+
+// Request is a request the server received
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+// Fault makes the server answer matching requests with an error
+type Fault struct {
+	// Method to match. Empty matches every method.
+	Method string
+	// PathPrefix to match below APIPrefix, e.g. "/machine/list". Empty matches every path.
+	PathPrefix string
+	// Status and Body of the response. A zero status only applies Delay.
+	Status int
+	Body   string
+	Header http.Header
+	// Delay before the request is answered
+	Delay time.Duration
+	// CloseConnection drops the connection without a response
+	CloseConnection bool
+	// Times is how often the fault applies. Zero means every time.
+	Times int
+}
+
+// session is an issued access token
+type session struct {
+	expiry time.Time
+	has2FA bool
+}
+
+// machineState is a machine with its flags and the own state of the player
+type machineState struct {
+	machine   htbapi.Machine
+	userFlag  string
+	rootFlag  string
+	userOwned bool
+	rootOwned bool
+}
+
+// challengeState is a challenge with its flag and files
+type challengeState struct {
+	challenge htbapi.Challenge
+	flag      string
+	file      []byte
+}
+
+// activeMachine is a spawned machine
+type activeMachine struct {
+	id         int
+	spawnedAt  time.Time
+	expiresAt  time.Time
+	resetAt    time.Time
+	extendedAt time.Time
+	voting     bool
+}
+
+// NewServer starts a fake api with the account DefaultEmail and DefaultPassword
+// without 2FA and without any machines or challenges. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		email:         DefaultEmail,
+		password:      DefaultPassword,
+		tokenTTL:      DefaultTokenTTL,
+		tokens:        map[string]*session{},
+		refreshTokens: map[string]bool{},
+		active:        map[string]*activeMachine{},
+		rankings:      map[string][]htbapi.Ranking{},
+		user: htbapi.UserInfo{
+			ID:       DefaultUserID,
+			Name:     DefaultUsername,
+			Email:    DefaultEmail,
+			Timezone: "UTC",
+		},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// BaseURL returns the base url to be used with htbapi.WithBaseURL
+func (s *Server) BaseURL() string {
+	return s.URL + APIPrefix
+}
+
+// SetCredentials sets the email and password of the account
+func (s *Server) SetCredentials(email, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.email = email
+	s.password = password
+}
+
+// Enable2FA turns on 2FA for the account. Logins need otp as one time password then.
+func (s *Server) Enable2FA(otp string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.otp = otp
+}
+
+// SetTokenTTL sets the lifetime of access tokens issued from now on
+func (s *Server) SetTokenTTL(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenTTL = d
+}
+
+// SetSpawnDelay sets how long a machine is spawning before it gets an ip
+func (s *Server) SetSpawnDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spawnDelay = d
+}
+
+// SetCooldown sets how long a machine cannot be reset or extended again
+func (s *Server) SetCooldown(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cooldown = d
+}
+
+// IssueToken returns a new valid access token, e.g. to be used as app token
+func (s *Server) IssueToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issueToken(true)
+}
+
+// RevokeTokens invalidates all issued access tokens before their expiry.
+// Requests using them will fail with 401. Refresh tokens stay valid.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = map[string]*session{}
+}
+
+// AddMachine adds a machine which can be spawned and owned with userFlag and rootFlag
+func (s *Server) AddMachine(m htbapi.Machine, userFlag, rootFlag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.machines = append(s.machines, &machineState{
+		machine:  m,
+		userFlag: userFlag,
+		rootFlag: rootFlag,
+	})
+}
+
+// SetReleaseArenaMachine sets the machine served in the release arena
+func (s *Server) SetReleaseArenaMachine(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseArena = id
+}
+
+// AddChallenge adds a challenge which can be owned with flag
+func (s *Server) AddChallenge(c htbapi.Challenge, flag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.challenges = append(s.challenges, &challengeState{
+		challenge: c,
+		flag:      flag,
+	})
+}
+
+// SetChallengeFile sets the zip archive served as download of the challenge with id
+func (s *Server) SetChallengeFile(id int, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cs := s.challenge(id); cs != nil {
+		cs.file = data
+	}
+}
+
+// SetUser replaces the account details of the logged in user
+func (s *Server) SetUser(info htbapi.UserInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user = info
+}
+
+// AddActivity adds an entry to the activity of the account. The latest entry goes first.
+func (s *Server) AddActivity(a htbapi.UserActivity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activity = append([]htbapi.UserActivity{a}, s.activity...)
+}
+
+// SetRankings sets the ranking of kind, which is "users", "teams" or "countries"
+func (s *Server) SetRankings(kind string, rankings []htbapi.Ranking) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rankings[kind] = rankings
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// Requests returns all requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns how many requests were received for method and path
+func (s *Server) RequestCount(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, r := range s.requests {
+		if r.Method == method && r.Path == path {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Spawned returns the id of the machine spawned in arena ("lab" or "release_arena")
+func (s *Server) Spawned(arena string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	am, ok := s.active[arena]
+	if !ok {
+		return 0, false
+	}
+
+	return am.id, true
+}
+
+// Owns reports whether user and root of machine id are owned
+func (s *Server) Owns(id int) (user, root bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ms := s.machine(id); ms != nil {
+		return ms.userOwned, ms.rootOwned
+	}
+
+	return false, false
+}
+
+// serveHTTP records the request, applies faults and routes it
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, APIPrefix) {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, APIPrefix)
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: path, Query: r.URL.Query(), Body: body})
+	fault := s.matchFault(r.Method, path)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if fault.CloseConnection {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+
+		if fault.Status != 0 {
+			for k, v := range fault.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(fault.Status)
+			w.Write([]byte(fault.Body))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.route(w, r, path, body)
+}
+
+// matchFault returns the first fault matching method and path and counts it down
+func (s *Server) matchFault(method, path string) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if !strings.HasPrefix(path, f.PathPrefix) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+
+		return f
+	}
+
+	return nil
+}
+
+// route dispatches the request to its handler. The lock is held.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	type route struct {
+		method  string
+		path    string
+		prefix  bool
+		auth    bool
+		handler func(w http.ResponseWriter, r *http.Request, path string, body []byte)
+	}
+
+	routes := []route{
+		{http.MethodPost, "/login", false, false, s.handleLogin},
+		{http.MethodPost, "/2fa/login", false, false, s.handleOTPLogin},
+		{http.MethodPost, "/login/refresh", false, false, s.handleRefresh},
+		{http.MethodGet, "/machine/list", false, true, s.handleMachineList(false)},
+		{http.MethodGet, "/machine/list/retired", false, true, s.handleMachineList(true)},
+		{http.MethodGet, "/machine/paginated", false, true, s.handleMachinePaginated(false)},
+		{http.MethodGet, "/machine/list/retired/paginated", false, true, s.handleMachinePaginated(true)},
+		{http.MethodGet, "/machine/profile/", true, true, s.handleMachineProfile},
+		{http.MethodGet, "/machine/active", false, true, s.handleActive("lab")},
+		{http.MethodPost, "/machine/own", false, true, s.handleOwn("lab")},
+		{http.MethodPost, "/vm/spawn", false, true, s.handleSpawn("lab")},
+		{http.MethodPost, "/vm/terminate", false, true, s.handleTerminate("lab")},
+		{http.MethodPost, "/vm/reset", false, true, s.handleReset("lab")},
+		{http.MethodPost, "/vm/extend", false, true, s.handleExtend("lab")},
+		{http.MethodPost, "/vm/reset/vote", false, true, s.handleResetVote("lab")},
+		{http.MethodPost, "/vm/reset/vote/accept", false, true, s.handleAcceptResetVote("lab")},
+		{http.MethodGet, "/release_arena/active", false, true, s.handleActive("release_arena")},
+		{http.MethodPost, "/release_arena/spawn", false, true, s.handleSpawn("release_arena")},
+		{http.MethodPost, "/release_arena/terminate", false, true, s.handleTerminate("release_arena")},
+		{http.MethodPost, "/release_arena/own", false, true, s.handleOwn("release_arena")},
+		{http.MethodPost, "/release_arena/reset", false, true, s.handleReset("release_arena")},
+		{http.MethodPost, "/release_arena/extend", false, true, s.handleExtend("release_arena")},
+		{http.MethodPost, "/release_arena/reset/vote", false, true, s.handleResetVote("release_arena")},
+		{http.MethodPost, "/release_arena/reset/vote/accept", false, true, s.handleAcceptResetVote("release_arena")},
+		{http.MethodGet, "/challenge/list", false, true, s.handleChallengeList(false)},
+		{http.MethodGet, "/challenge/list/retired", false, true, s.handleChallengeList(true)},
+		{http.MethodGet, "/challenge/info/", true, true, s.handleChallengeInfo},
+		{http.MethodGet, "/challenge/download/", true, true, s.handleChallengeDownload},
+		{http.MethodPost, "/challenge/own", false, true, s.handleChallengeOwn},
+		{http.MethodGet, "/user/info", false, true, s.handleUserInfo},
+		{http.MethodGet, "/user/profile/basic/", true, true, s.handleUserProfile},
+		{http.MethodGet, "/user/profile/activity/", true, true, s.handleUserActivity},
+		{http.MethodGet, "/rankings/", true, true, s.handleRankings},
+		{http.MethodGet, "/connections", false, true, s.handleConnections},
+	}
+
+	for _, rt := range routes {
+		if rt.prefix && !strings.HasPrefix(path, rt.path) || !rt.prefix && path != rt.path {
+			continue
+		}
+		if r.Method != rt.method {
+			writeJSON(w, http.StatusMethodNotAllowed, message("Method Not Allowed"))
+			return
+		}
+		if rt.auth && !s.authorized(r) {
+			writeJSON(w, http.StatusUnauthorized, message("Unauthenticated."))
+			return
+		}
+
+		rt.handler(w, r, path, body)
+		return
+	}
+
+	writeJSON(w, http.StatusNotFound, message("Not Found"))
+}
+
+// authorized reports whether the request carries a valid fully logged in token
+func (s *Server) authorized(r *http.Request) bool {
+	t := s.session(r)
+
+	return t != nil && (t.has2FA || s.otp == "")
+}
+
+// session returns the unexpired session of the bearer token of r
+func (s *Server) session(r *http.Request) *session {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	t, ok := s.tokens[token]
+	if !ok || time.Now().After(t.expiry) {
+		return nil
+	}
+
+	return t
+}
+
+// issueToken creates a JWT shaped access token. The lock is held.
+func (s *Server) issueToken(has2FA bool) string {
+	now := time.Now()
+	expiry := now.Add(s.tokenTTL)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"none"}`))
+	payload, _ := json.Marshal(map[string]interface{}{
+		"aud": "1",
+		"jti": randomHex(16),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": expiry.Unix(),
+		"sub": "1",
+	})
+	token := header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".htbtest"
+
+	s.tokens[token] = &session{expiry: expiry, has2FA: has2FA}
+
+	return token
+}
+
+// loginMessage issues a new access and refresh token. The lock is held.
+func (s *Server) loginMessage(has2FA bool) htbapi.LoginResponse {
+	refreshToken := randomHex(32)
+	s.refreshTokens[refreshToken] = true
+
+	return htbapi.LoginResponse{
+		Message: htbapi.LoginResponseMessage{
+			AccessToken:  s.issueToken(has2FA),
+			Is2FAEnabled: s.otp != "",
+			RefreshToken: refreshToken,
+			TokenHas2FA:  has2FA,
+		},
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	var req htbapi.LoginBody
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, message("Invalid request"))
+		return
+	}
+
+	if req.Email != s.email || req.Password != s.password {
+		writeJSON(w, http.StatusUnauthorized, message("Wrong email or password"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.loginMessage(s.otp == ""))
+}
+
+func (s *Server) handleOTPLogin(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	t := s.session(r)
+	if t == nil {
+		writeJSON(w, http.StatusUnauthorized, message("Unauthenticated."))
+		return
+	}
+
+	var req htbapi.OTPBody
+	if err := json.Unmarshal(body, &req); err != nil || req.OneTimePassword != s.otp {
+		writeJSON(w, http.StatusBadRequest, message("Wrong one time password"))
+		return
+	}
+
+	t.has2FA = true
+	writeJSON(w, http.StatusOK, htbapi.OTPLoginResponse{Message: "correct"})
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || !s.refreshTokens[req.RefreshToken] {
+		writeJSON(w, http.StatusUnauthorized, message("Invalid refresh token"))
+		return
+	}
+
+	// Refresh tokens can only be used once
+	delete(s.refreshTokens, req.RefreshToken)
+
+	writeJSON(w, http.StatusOK, s.loginMessage(true))
+}
+
+func (s *Server) handleMachineList(retired bool) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		machines := []htbapi.Machine{}
+		for _, ms := range s.machines {
+			if (ms.machine.Retired == 1) == retired {
+				machines = append(machines, s.machineInfo(ms))
+			}
+		}
+
+		writeCacheableJSON(w, r, htbapi.GetMachinesResponse{Machines: machines})
+	}
+}
+
+// handleMachinePaginated serves the machine list filtered, sorted and paginated
+// by the query parameters. Tags are ignored as the machines have none.
+func (s *Server) handleMachinePaginated(retired bool) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		q := r.URL.Query()
+
+		machines := []htbapi.Machine{}
+		for _, ms := range s.machines {
+			m := s.machineInfo(ms)
+			if (m.Retired == 1) == retired && matchMachine(q, m) {
+				machines = append(machines, m)
+			}
+		}
+		sortMachines(q, machines)
+
+		writeJSON(w, http.StatusOK, paginate(r, machines))
+	}
+}
+
+func (s *Server) handleRankings(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	rankings, ok := s.rankings[strings.TrimPrefix(path, "/rankings/")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, message("Not Found"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, paginate(r, rankings))
+}
+
+// matchMachine reports whether m matches the filters in q
+func matchMachine(q url.Values, m htbapi.Machine) bool {
+	if os := q["os[]"]; len(os) > 0 && !containsFold(os, m.OS) {
+		return false
+	}
+	if difficulty := q["difficulty[]"]; len(difficulty) > 0 && !containsFold(difficulty, m.DifficultyText) {
+		return false
+	}
+	if free := q.Get("free"); free != "" && m.Free != (free == "1") {
+		return false
+	}
+	if owned := q.Get("owned"); owned != "" && (m.AuthUserInUserOwns && m.AuthUserInRootOwns) != (owned == "1") {
+		return false
+	}
+	if todo := q.Get("todo"); todo != "" && m.IsTodo != (todo == "1") {
+		return false
+	}
+	if keyword := q.Get("keyword"); keyword != "" && !strings.Contains(strings.ToLower(m.Name), strings.ToLower(keyword)) {
+		return false
+	}
+
+	return true
+}
+
+// sortMachines orders machines by sort_by and sort_type in q
+func sortMachines(q url.Values, machines []htbapi.Machine) {
+	var less func(a, b htbapi.Machine) bool
+	switch q.Get("sort_by") {
+	case "release-date":
+		less = func(a, b htbapi.Machine) bool { return a.Release.Before(b.Release) }
+	case "name":
+		less = func(a, b htbapi.Machine) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "difficulty":
+		less = func(a, b htbapi.Machine) bool { return a.Difficulty < b.Difficulty }
+	case "user-owns":
+		less = func(a, b htbapi.Machine) bool { return a.UserOwnsCount < b.UserOwnsCount }
+	case "root-owns":
+		less = func(a, b htbapi.Machine) bool { return a.RootOwnsCount < b.RootOwnsCount }
+	default:
+		return
+	}
+
+	desc := q.Get("sort_type") == "desc"
+	sort.SliceStable(machines, func(i, j int) bool {
+		if desc {
+			return less(machines[j], machines[i])
+		}
+		return less(machines[i], machines[j])
+	})
+}
+
+// paginate returns the page of items requested by the page and per_page parameters
+// with links and meta like the paginated endpoints of the api
+func paginate[T any](r *http.Request, items []T) htbapi.Page[T] {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 15
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	lastPage := (len(items) + perPage - 1) / perPage
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	link := func(page int) string {
+		if page < 1 || page > lastPage {
+			return ""
+		}
+
+		u := *r.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	return htbapi.Page[T]{
+		Data: items[start:end],
+		Links: &htbapi.PageLinks{
+			First: link(1),
+			Last:  link(lastPage),
+			Prev:  link(page - 1),
+			Next:  link(page + 1),
+		},
+		Meta: &htbapi.PageMeta{
+			CurrentPage: page,
+			LastPage:    lastPage,
+			PerPage:     perPage,
+			Total:       len(items),
+		},
+	}
+}
+
+// containsFold reports whether list contains s ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) handleMachineProfile(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/machine/profile/"))
+	ms := s.machine(id)
+	if err != nil || ms == nil {
+		writeJSON(w, http.StatusNotFound, message("Machine not found"))
+		return
+	}
+
+	writeCacheableJSON(w, r, htbapi.GetMachineRepsonse{Machine: s.machineInfo(ms)})
+}
+
+func (s *Server) handleActive(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		am, ok := s.active[arena]
+		if !ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"info": nil})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, htbapi.SpawnedMachineInfoResponse{Info: s.machineInfo(s.machine(am.id))})
+	}
+}
+
+func (s *Server) handleSpawn(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		id, ok := s.requestedMachine(arena, body)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, message("Machine not found"))
+			return
+		}
+
+		if _, spawned := s.active[arena]; spawned {
+			writeJSON(w, http.StatusBadRequest, htbapi.SpawnMachineResponse{Message: "You have already spawned a machine. Terminate it first."})
+			return
+		}
+
+		now := time.Now()
+		s.active[arena] = &activeMachine{
+			id:        id,
+			spawnedAt: now,
+			expiresAt: now.Add(machineLifetime),
+		}
+
+		writeJSON(w, http.StatusOK, htbapi.SpawnMachineResponse{Message: "Machine deployed", Success: 1})
+	}
+}
+
+func (s *Server) handleTerminate(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		am, ok := s.active[arena]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, htbapi.SpawnMachineResponse{Message: "No machine is running"})
+			return
+		}
+
+		if id, ok := s.requestedMachine(arena, body); !ok || id != am.id {
+			writeJSON(w, http.StatusBadRequest, htbapi.SpawnMachineResponse{Message: "This machine is not running"})
+			return
+		}
+
+		delete(s.active, arena)
+		writeJSON(w, http.StatusOK, htbapi.SpawnMachineResponse{Message: "Machine terminated", Success: 1})
+	}
+}
+
+// runningMachine returns the spawned machine of arena if the request names it.
+// Otherwise it writes the error response.
+func (s *Server) runningMachine(w http.ResponseWriter, arena string, body []byte) (*activeMachine, bool) {
+	am, ok := s.active[arena]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, message("No machine is running"))
+		return nil, false
+	}
+
+	if id, ok := s.requestedMachine(arena, body); !ok || id != am.id {
+		writeJSON(w, http.StatusBadRequest, message("This machine is not running"))
+		return nil, false
+	}
+
+	return am, true
+}
+
+// coolingDown writes a cooldown error if last is less than the cooldown ago
+func (s *Server) coolingDown(w http.ResponseWriter, action string, last time.Time) bool {
+	if last.IsZero() || !time.Now().Before(last.Add(s.cooldown)) {
+		return false
+	}
+
+	left := time.Until(last.Add(s.cooldown)).Round(time.Second)
+	writeJSON(w, http.StatusBadRequest, message(fmt.Sprintf("You must wait %s before you can %s this machine again.", left, action)))
+	return true
+}
+
+// lifecycleResponse returns the response of a reset, extend or vote request
+func lifecycleResponse(msg string, am *activeMachine, votes int) htbapi.LifecycleResponse {
+	return htbapi.LifecycleResponse{
+		Message:     msg,
+		ExpiresAt:   am.expiresAt.UTC().Format(expiryLayout),
+		Votes:       votes,
+		VotesNeeded: 1,
+	}
+}
+
+func (s *Server) handleReset(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		am, ok := s.runningMachine(w, arena, body)
+		if !ok || s.coolingDown(w, "reset", am.resetAt) {
+			return
+		}
+
+		now := time.Now()
+		am.spawnedAt = now
+		am.resetAt = now
+		am.voting = false
+
+		writeJSON(w, http.StatusOK, lifecycleResponse(s.machine(am.id).machine.Name+" will be reset in a few seconds.", am, 0))
+	}
+}
+
+func (s *Server) handleExtend(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		am, ok := s.runningMachine(w, arena, body)
+		if !ok || s.coolingDown(w, "extend", am.extendedAt) {
+			return
+		}
+
+		am.expiresAt = am.expiresAt.Add(machineLifetime)
+		am.extendedAt = time.Now()
+
+		writeJSON(w, http.StatusOK, lifecycleResponse("Machine extended.", am, 0))
+	}
+}
+
+func (s *Server) handleResetVote(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		am, ok := s.runningMachine(w, arena, body)
+		if !ok || s.coolingDown(w, "reset", am.resetAt) {
+			return
+		}
+		if am.voting {
+			writeJSON(w, http.StatusBadRequest, message("A reset vote is already in progress."))
+			return
+		}
+
+		am.voting = true
+		writeJSON(w, http.StatusOK, lifecycleResponse("Reset vote started.", am, 0))
+	}
+}
+
+// handleAcceptResetVote resets the machine, as the player is the only one voting
+func (s *Server) handleAcceptResetVote(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		am, ok := s.runningMachine(w, arena, body)
+		if !ok {
+			return
+		}
+		if !am.voting {
+			writeJSON(w, http.StatusBadRequest, message("There is no reset vote in progress."))
+			return
+		}
+
+		now := time.Now()
+		am.spawnedAt = now
+		am.resetAt = now
+		am.voting = false
+
+		writeJSON(w, http.StatusOK, lifecycleResponse("Vote accepted, the machine will be reset.", am, 1))
+	}
+}
+
+func (s *Server) handleOwn(arena string) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		var req htbapi.Submission
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeJSON(w, http.StatusBadRequest, message("Invalid request"))
+			return
+		}
+
+		ms := s.machine(req.ID)
+		am, ok := s.active[arena]
+		if ms == nil || !ok || am.id != req.ID {
+			writeJSON(w, http.StatusBadRequest, htbapi.SubmissionResponse{Status: http.StatusBadRequest, Message: "Machine is not running"})
+			return
+		}
+
+		switch req.Flag {
+		case ms.userFlag:
+			ms.userOwned = true
+			writeJSON(w, http.StatusOK, htbapi.SubmissionResponse{Status: http.StatusOK, Success: "1", Message: ms.machine.Name + " user is now owned."})
+		case ms.rootFlag:
+			ms.rootOwned = true
+			writeJSON(w, http.StatusOK, htbapi.SubmissionResponse{Status: http.StatusOK, Success: "1", Message: ms.machine.Name + " root is now owned."})
+		default:
+			writeJSON(w, http.StatusBadRequest, htbapi.SubmissionResponse{Status: http.StatusBadRequest, Message: "Incorrect Flag!"})
+		}
+	}
+}
+
+func (s *Server) handleChallengeList(retired bool) func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	return func(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+		challenges := []htbapi.Challenge{}
+		for _, cs := range s.challenges {
+			if (cs.challenge.Retired == 1) == retired {
+				challenges = append(challenges, cs.challenge)
+			}
+		}
+
+		writeCacheableJSON(w, r, htbapi.GetChallengesResponse{Challenges: challenges})
+	}
+}
+
+func (s *Server) handleChallengeInfo(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/challenge/info/"))
+	cs := s.challenge(id)
+	if err != nil || cs == nil {
+		writeJSON(w, http.StatusNotFound, message("Challenge not found"))
+		return
+	}
+
+	writeCacheableJSON(w, r, htbapi.GetChallengeRepsonse{Challenge: cs.challenge})
+}
+
+func (s *Server) handleChallengeDownload(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/challenge/download/"))
+	cs := s.challenge(id)
+	if err != nil || cs == nil || cs.file == nil {
+		writeJSON(w, http.StatusNotFound, message("Challenge not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cs.challenge.Name+".zip"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(cs.file)
+}
+
+func (s *Server) handleChallengeOwn(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	var req struct {
+		ChallengeID int    `json:"challenge_id"`
+		Flag        string `json:"flag"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, message("Invalid request"))
+		return
+	}
+
+	cs := s.challenge(req.ChallengeID)
+	if cs == nil {
+		writeJSON(w, http.StatusNotFound, message("Challenge not found"))
+		return
+	}
+
+	if req.Flag != cs.flag {
+		writeJSON(w, http.StatusBadRequest, message("Incorrect Flag!"))
+		return
+	}
+
+	cs.challenge.AuthUserSolve = true
+	writeJSON(w, http.StatusOK, message("Congratulations! You have owned "+cs.challenge.Name))
+}
+
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	data := map[string]htbapi.VPNServer{}
+	for i, endpoint := range htbapi.EnumVPNEndpoints {
+		data[endpoint] = htbapi.VPNServer{
+			CanAccess:                true,
+			LocationTypeFriendlyName: "EU - " + endpoint,
+			Available:                true,
+			AssignedServer: htbapi.AssignedServer{
+				ID:           i + 1,
+				FriendlyName: "EU " + endpoint + " 1",
+				Location:     "EU",
+			},
+		}
+	}
+
+	if am, ok := s.active["lab"]; ok {
+		lab := data["lab"]
+		lab.Machine = s.machineInfo(s.machine(am.id))
+		data["lab"] = lab
+	}
+	if ms := s.machine(s.releaseArena); ms != nil {
+		ra := data["release_arena"]
+		ra.Machine = s.machineInfo(ms)
+		data["release_arena"] = ra
+	}
+
+	writeJSON(w, http.StatusOK, htbapi.Connections{Status: true, Data: data})
+}
+
+// requestedMachine returns the machine id of a spawn or terminate request.
+// The release arena always uses its configured machine.
+func (s *Server) requestedMachine(arena string, body []byte) (int, bool) {
+	if arena == "release_arena" {
+		return s.releaseArena, s.machine(s.releaseArena) != nil
+	}
+
+	var req struct {
+		MachineID int `json:"machine_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, false
+	}
+
+	return req.MachineID, s.machine(req.MachineID) != nil
+}
+
+// machineInfo returns the machine as seen by the player including spawn and own state
+func (s *Server) machineInfo(ms *machineState) htbapi.Machine {
+	m := ms.machine
+	m.AuthUserInUserOwns = ms.userOwned
+	m.AuthUserInRootOwns = ms.rootOwned
+	m.IP = ""
+
+	for _, am := range s.active {
+		if am.id != m.ID {
+			continue
+		}
+
+		spawning := time.Now().Before(am.spawnedAt.Add(s.spawnDelay))
+		m.IsSpawning = spawning
+		m.ExpiresAt = am.expiresAt.UTC().Format(expiryLayout)
+		m.PlayInfo = htbapi.PlayInfo{
+			ActivePlayerCount: 1,
+			ExpiresAt:         m.ExpiresAt,
+			IsActive:          true,
+			IsSpawend:         !spawning,
+			IsSpawning:        spawning,
+		}
+		if !spawning {
+			m.IP = fmt.Sprintf("10.10.11.%d", m.ID%250+1)
+		}
+	}
+
+	return m
+}
+
+// machine returns the machine with id or nil
+func (s *Server) machine(id int) *machineState {
+	for _, ms := range s.machines {
+		if ms.machine.ID == id {
+			return ms
+		}
+	}
+
+	return nil
+}
+
+// challenge returns the challenge with id or nil
+func (s *Server) challenge(id int) *challengeState {
+	for _, cs := range s.challenges {
+		if cs.challenge.ID == id {
+			return cs
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	writeJSON(w, http.StatusOK, htbapi.GetUserInfoResponse{Info: s.user})
+}
+
+// handleUserActivity serves the activity of the account in one response like the api does
+func (s *Server) handleUserActivity(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/user/profile/activity/"))
+	if err != nil || id != s.user.ID {
+		writeJSON(w, http.StatusNotFound, message("User not found"))
+		return
+	}
+
+	activity := s.activity
+	if activity == nil {
+		activity = []htbapi.UserActivity{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"profile": map[string]interface{}{"activity": activity},
+	})
+}
+
+func (s *Server) handleUserProfile(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/user/profile/basic/"))
+	if err != nil || id != s.user.ID {
+		writeJSON(w, http.StatusNotFound, message("User not found"))
+		return
+	}
+
+	profile := htbapi.UserProfile{
+		ID:       s.user.ID,
+		Name:     s.user.Name,
+		Avatar:   s.user.Avatar,
+		IsVIP:    s.user.IsVIP,
+		Timezone: s.user.Timezone,
+		Rank:     "Noob",
+	}
+	for _, ms := range s.machines {
+		if ms.userOwned {
+			profile.UserOwns++
+		}
+		if ms.rootOwned {
+			profile.SystemOwns++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, htbapi.GetUserProfileResponse{Profile: profile})
+}
+
+// message returns the error body format of the api
+func message(msg string) map[string]string {
+	return map[string]string{"message": msg}
+}
+
+// writeJSON writes v as json response with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeCacheableJSON writes v as json response with an ETag. If the request
+// carries the same ETag in If-None-Match only 304 Not Modified is sent.
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(data, '\n'))
+}
+
+// randomHex returns n random bytes as hex string
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
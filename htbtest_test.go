@@ -0,0 +1,46 @@
+package htbapi_test
+
+import (
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// newTestServer starts a fake api which is closed with the test
+func newTestServer(t *testing.T) *htbtest.Server {
+	t.Helper()
+
+	s := htbtest.NewServer()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// newTestAPI returns an API talking to s with the default account. Retries
+// are disabled unless opts set another policy.
+func newTestAPI(t *testing.T, s *htbtest.Server, opts ...htbapi.Option) *htbapi.API {
+	t.Helper()
+
+	opts = append([]htbapi.Option{
+		htbapi.WithBaseURL(s.BaseURL()),
+		htbapi.WithCredentials(htbtest.DefaultEmail, htbtest.DefaultPassword, false),
+		htbapi.WithRetryPolicy(htbapi.RetryPolicy{MaxAttempts: 1}),
+	}, opts...)
+
+	a, err := htbapi.New(opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	return a
+}
+
+// login logs a in and fails the test on error
+func login(t *testing.T, a *htbapi.API) {
+	t.Helper()
+
+	if err := a.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+}
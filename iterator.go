@@ -0,0 +1,318 @@
+package htbapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// PageMeta is the pagination info of a paginated response
+type PageMeta struct {
+	CurrentPage int `json:"current_page"`
+	LastPage    int `json:"last_page"`
+	PerPage     int `json:"per_page"`
+	Total       int `json:"total"`
+}
+
+// PageLinks are the urls of the neighbouring pages of a paginated response
+type PageLinks struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Prev  string `json:"prev"`
+	Next  string `json:"next"`
+}
+
+// Page is one page of a paginated list endpoint
+type Page[T any] struct {
+	Data  []T        `json:"data"`
+	Links *PageLinks `json:"links"`
+	Meta  *PageMeta  `json:"meta"`
+}
+
+// last reports whether no page follows p. Responses without meta follow their
+// next link or are a single page otherwise.
+func (p Page[T]) last() bool {
+	if p.Meta != nil {
+		return p.Meta.CurrentPage >= p.Meta.LastPage
+	}
+
+	return p.Links == nil || p.Links.Next == ""
+}
+
+// PageFunc fetches the page with number page, starting at 1
+type PageFunc[T any] func(ctx context.Context, page int) (Page[T], error)
+
+// pageResult is a page fetched ahead
+type pageResult[T any] struct {
+	page Page[T]
+	err  error
+}
+
+// Pager walks through the pages of a paginated list and fetches them lazily when
+// they are needed. With Prefetch pages are fetched ahead in the background.
+type Pager[T any] struct {
+	ctx      context.Context
+	fetch    PageFunc[T]
+	prefetch int
+
+	number  int
+	current Page[T]
+	last    bool
+	err     error
+	closed  bool
+
+	// results holds the pages fetched ahead. The background fetch only runs
+	// while there is room in it, so it never blocks on a pager nobody reads.
+	results  chan pageResult[T]
+	fetchCtx context.Context
+	cancel   context.CancelFunc
+
+	mu       sync.Mutex
+	running  bool
+	fetched  int
+	finished bool
+}
+
+// NewPager returns a Pager fetching its pages with fetch. Pages are fetched
+// with ctx, so canceling it stops the pager.
+func NewPager[T any](ctx context.Context, fetch PageFunc[T]) *Pager[T] {
+	return &Pager[T]{ctx: ctx, fetch: fetch}
+}
+
+// Prefetch makes the pager fetch up to n pages ahead in the background. Call it
+// before the first Next. A pager which is not read to the end has to be closed,
+// otherwise the fetches in the background keep running until n pages are fetched.
+func (p *Pager[T]) Prefetch(n int) *Pager[T] {
+	p.prefetch = n
+	return p
+}
+
+// Next advances to the next page and reports whether there is one.
+// It returns false once all pages are read, a page failed or the pager
+// was closed, see Err.
+func (p *Pager[T]) Next() bool {
+	if p.last || p.err != nil || p.closed {
+		return false
+	}
+
+	if p.prefetch > 0 {
+		return p.nextPrefetched()
+	}
+
+	if err := p.ctx.Err(); err != nil {
+		p.err = err
+		return false
+	}
+
+	p.number++
+	page, err := p.fetch(p.ctx, p.number)
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	p.current = page
+	p.last = page.last()
+	return true
+}
+
+// nextPrefetched advances to the next page fetched in the background
+func (p *Pager[T]) nextPrefetched() bool {
+	if p.results == nil {
+		p.fetchCtx, p.cancel = context.WithCancel(p.ctx)
+		p.results = make(chan pageResult[T], p.prefetch)
+	}
+	p.fill()
+
+	select {
+	case r := <-p.results:
+		if r.err != nil {
+			p.err = r.err
+			p.Close()
+			return false
+		}
+
+		p.number++
+		p.current = r.page
+		p.last = r.page.last()
+		if p.last {
+			p.Close()
+		} else {
+			p.fill()
+		}
+		return true
+	case <-p.fetchCtx.Done():
+		p.err = p.ctx.Err()
+		p.Close()
+		return false
+	}
+}
+
+// fill starts fetching pages in the background unless it is running already
+// or the last page was fetched
+func (p *Pager[T]) fill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running || p.finished {
+		return
+	}
+	p.running = true
+
+	go func() {
+		for {
+			p.mu.Lock()
+			if p.finished || len(p.results) == cap(p.results) || p.fetchCtx.Err() != nil {
+				p.running = false
+				p.mu.Unlock()
+				return
+			}
+			p.fetched++
+			number := p.fetched
+			p.mu.Unlock()
+
+			page, err := p.fetch(p.fetchCtx, number)
+
+			p.mu.Lock()
+			p.finished = err != nil || page.last()
+			p.mu.Unlock()
+
+			// There is room as only this goroutine sends and Next only receives
+			p.results <- pageResult[T]{page: page, err: err}
+		}
+	}()
+}
+
+// Page returns the current page
+func (p *Pager[T]) Page() Page[T] {
+	return p.current
+}
+
+// Number returns the number of the current page
+func (p *Pager[T]) Number() int {
+	return p.number
+}
+
+// Err returns the error which stopped the pager, if any
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// Close stops fetching pages in the background and makes Next return false.
+// It is safe to call it more than once.
+func (p *Pager[T]) Close() {
+	p.closed = true
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// Iterator walks through the items of a paginated list page by page, see Pager.
+// Close it if it prefetches and is not read to the end:
+//
+//	it := a.Machines.Query(ctx, htbapi.MachineQuery{OS: []string{"linux"}}).Prefetch(2)
+//	defer it.Close()
+//	for it.Next() {
+//		m := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	pager *Pager[T]
+	items []T
+	value T
+}
+
+// NewIterator returns an Iterator fetching its pages with fetch. Pages are
+// fetched with ctx, so canceling it stops the iteration.
+func NewIterator[T any](ctx context.Context, fetch PageFunc[T]) *Iterator[T] {
+	return &Iterator[T]{pager: NewPager(ctx, fetch)}
+}
+
+// Prefetch makes the iterator fetch up to n pages ahead, see Pager.Prefetch
+func (it *Iterator[T]) Prefetch(n int) *Iterator[T] {
+	it.pager.Prefetch(n)
+	return it
+}
+
+// Next advances to the next item and reports whether there is one.
+// It returns false once all pages are read or a page failed, see Err.
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if !it.pager.Next() {
+			return false
+		}
+		it.items = it.pager.Page().Data
+	}
+
+	it.value, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value returns the current item
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.pager.Err()
+}
+
+// Close stops fetching pages in the background, see Pager.Close
+func (it *Iterator[T]) Close() {
+	it.pager.Close()
+}
+
+// All collects the remaining items of all pages
+func (it *Iterator[T]) All() ([]T, error) {
+	defer it.Close()
+
+	var all []T
+	for it.Next() {
+		all = append(all, it.Value())
+	}
+
+	return all, it.Err()
+}
+
+// listPage fetches page of a list endpoint. Endpoints which are not paginated return
+// the whole list nested under keys instead of data, which is read as a single page.
+func listPage[T any](ctx context.Context, a *API, endpoint string, page int, keys ...string) (Page[T], error) {
+	r := a.NewRequest(http.MethodGet, endpoint).
+		Query("page", strconv.Itoa(page)).
+		Query("per_page", strconv.Itoa(DefaultPerPage))
+
+	raw, err := Fetch[json.RawMessage](ctx, r)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	var p Page[T]
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return p, err
+	}
+	if p.Data != nil || len(keys) == 0 {
+		return p, nil
+	}
+
+	for _, key := range keys {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return p, err
+		}
+		raw = fields[key]
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &p.Data); err != nil {
+			return p, err
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,205 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+// pages serves fixed pages and counts the fetches
+type pages struct {
+	data [][]int
+	// meta sends PageMeta, otherwise the last page is found by its missing next link
+	meta bool
+	// block makes fetches of pages from this number on wait until their ctx is done
+	block int
+
+	mu      sync.Mutex
+	fetched []int
+	running int
+}
+
+func (p *pages) fetch(ctx context.Context, number int) (htbapi.Page[int], error) {
+	p.mu.Lock()
+	p.fetched = append(p.fetched, number)
+	p.running++
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	}()
+
+	if p.block > 0 && number >= p.block {
+		<-ctx.Done()
+		return htbapi.Page[int]{}, ctx.Err()
+	}
+
+	page := htbapi.Page[int]{Data: p.data[number-1]}
+	if p.meta {
+		page.Meta = &htbapi.PageMeta{CurrentPage: number, LastPage: len(p.data)}
+	} else if number < len(p.data) {
+		page.Links = &htbapi.PageLinks{Next: "next"}
+	}
+
+	return page, nil
+}
+
+// state returns the numbers of all fetched pages and the number of running fetches
+func (p *pages) state() ([]int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]int(nil), p.fetched...), p.running
+}
+
+// settle waits until no fetch of p is running
+func (p *pages) settle(t *testing.T) []int {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		fetched, running := p.state()
+		if running == 0 {
+			// Give a stuck background fetch the chance to show up
+			time.Sleep(20 * time.Millisecond)
+			if again, running := p.state(); running == 0 && len(again) == len(fetched) {
+				return fetched
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d fetches still running", running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIteratorAll(t *testing.T) {
+	for _, prefetch := range []int{0, 1, 3} {
+		for _, meta := range []bool{true, false} {
+			// The empty page in between must not end the iteration
+			p := &pages{data: [][]int{{1, 2}, {}, {3}, {4, 5}}, meta: meta}
+
+			all, err := htbapi.NewIterator(context.Background(), p.fetch).Prefetch(prefetch).All()
+			if err != nil {
+				t.Fatalf("prefetch %d meta %v: All: %v", prefetch, meta, err)
+			}
+			if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(all, want) {
+				t.Errorf("prefetch %d meta %v: All = %v, want %v", prefetch, meta, all, want)
+			}
+			if fetched := p.settle(t); !reflect.DeepEqual(fetched, []int{1, 2, 3, 4}) {
+				t.Errorf("prefetch %d meta %v: fetched pages %v, want 1 to 4 once", prefetch, meta, fetched)
+			}
+		}
+	}
+}
+
+func TestPagerBoundaries(t *testing.T) {
+	p := &pages{data: [][]int{{1}, {2}, {3}}, meta: true}
+	pager := htbapi.NewPager(context.Background(), p.fetch)
+
+	for want := 1; want <= 3; want++ {
+		if !pager.Next() {
+			t.Fatalf("Next of page %d: %v", want, pager.Err())
+		}
+		if pager.Number() != want || pager.Page().Data[0] != want {
+			t.Errorf("page %d = %v, want page %d", pager.Number(), pager.Page().Data, want)
+		}
+	}
+
+	if pager.Next() {
+		t.Error("Next after the last page = true")
+	}
+	if err := pager.Err(); err != nil {
+		t.Errorf("Err = %v, want nil", err)
+	}
+	if fetched, _ := p.state(); len(fetched) != 3 {
+		t.Errorf("fetched pages %v, want no page after the last one", fetched)
+	}
+}
+
+func TestPagerError(t *testing.T) {
+	errPage := errors.New("page failed")
+	fetch := func(ctx context.Context, number int) (htbapi.Page[int], error) {
+		if number == 2 {
+			return htbapi.Page[int]{}, errPage
+		}
+		return htbapi.Page[int]{Data: []int{number}, Links: &htbapi.PageLinks{Next: "next"}}, nil
+	}
+
+	for _, prefetch := range []int{0, 2} {
+		all, err := htbapi.NewIterator(context.Background(), fetch).Prefetch(prefetch).All()
+		if !errors.Is(err, errPage) {
+			t.Errorf("prefetch %d: All error = %v, want the page error", prefetch, err)
+		}
+		if !reflect.DeepEqual(all, []int{1}) {
+			t.Errorf("prefetch %d: All = %v, want the items before the error", prefetch, all)
+		}
+	}
+}
+
+func TestPagerCancelMidPrefetch(t *testing.T) {
+	p := &pages{data: [][]int{{1}, {2}, {3}, {4}}, meta: true, block: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	pager := htbapi.NewPager(ctx, p.fetch).Prefetch(2)
+
+	if !pager.Next() {
+		t.Fatalf("Next: %v", pager.Err())
+	}
+
+	// Page 2 is being fetched in the background when ctx is canceled
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if pager.Next() {
+		t.Error("Next after cancel = true")
+	}
+	if !errors.Is(pager.Err(), context.Canceled) {
+		t.Errorf("Err = %v, want Canceled", pager.Err())
+	}
+
+	if fetched := p.settle(t); !reflect.DeepEqual(fetched, []int{1, 2}) {
+		t.Errorf("fetched pages %v, want 1 and 2", fetched)
+	}
+}
+
+func TestPagerClose(t *testing.T) {
+	p := &pages{data: [][]int{{1}, {2}, {3}, {4}}, meta: true, block: 2}
+	pager := htbapi.NewPager(context.Background(), p.fetch).Prefetch(2)
+
+	if !pager.Next() {
+		t.Fatalf("Next: %v", pager.Err())
+	}
+	pager.Close()
+	pager.Close()
+
+	if pager.Next() {
+		t.Error("Next after Close = true")
+	}
+	if fetched := p.settle(t); !reflect.DeepEqual(fetched, []int{1, 2}) {
+		t.Errorf("fetched pages %v, want 1 and 2", fetched)
+	}
+}
+
+func TestPagerAbandoned(t *testing.T) {
+	data := make([][]int, 100)
+	for i := range data {
+		data[i] = []int{i + 1}
+	}
+	p := &pages{data: data, meta: true}
+	pager := htbapi.NewPager(context.Background(), p.fetch).Prefetch(2)
+
+	if !pager.Next() {
+		t.Fatalf("Next: %v", pager.Err())
+	}
+
+	// Without Close the background fetch stops once 2 pages are fetched ahead
+	if fetched := p.settle(t); !reflect.DeepEqual(fetched, []int{1, 2, 3}) {
+		t.Errorf("fetched pages %v, want 1 to 3", fetched)
+	}
+}
@@ -0,0 +1,161 @@
+package htbapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrMalformedToken is returned if an access_token is no valid JWT
+var ErrMalformedToken = errors.New("malformed token")
+
+// TokenClaims holds the registered claims of an access_token.
+// Time claims which are not present in the token are the zero time.
+type TokenClaims struct {
+	Audience  []string
+	ExpiresAt time.Time
+	ID        string
+	IssuedAt  time.Time
+	NotBefore time.Time
+	Subject   string
+}
+
+// rawClaims is used to decode the payload. Numbers are kept as json.Number because
+// some issuers send fractional timestamps.
+type rawClaims struct {
+	AUD json.RawMessage `json:"aud"`
+	EXP json.Number     `json:"exp"`
+	IAT json.Number     `json:"iat"`
+	JTI json.RawMessage `json:"jti"`
+	NBF json.Number     `json:"nbf"`
+	SUB json.RawMessage `json:"sub"`
+}
+
+// ParseToken will decode the payload of the JWT token and return its claims.
+// The signature is not verified as only hackthebox has the key to do so.
+func ParseToken(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrMalformedToken, len(parts))
+	}
+
+	data, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %+v", ErrMalformedToken, err)
+	}
+
+	var raw rawClaims
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %+v", ErrMalformedToken, err)
+	}
+
+	claims := &TokenClaims{}
+	if claims.ExpiresAt, err = numericDate(raw.EXP); err != nil {
+		return nil, fmt.Errorf("%w: exp: %+v", ErrMalformedToken, err)
+	}
+	if claims.IssuedAt, err = numericDate(raw.IAT); err != nil {
+		return nil, fmt.Errorf("%w: iat: %+v", ErrMalformedToken, err)
+	}
+	if claims.NotBefore, err = numericDate(raw.NBF); err != nil {
+		return nil, fmt.Errorf("%w: nbf: %+v", ErrMalformedToken, err)
+	}
+	if claims.Audience, err = stringList(raw.AUD); err != nil {
+		return nil, fmt.Errorf("%w: aud: %+v", ErrMalformedToken, err)
+	}
+	if claims.Subject, err = stringOrNumber(raw.SUB); err != nil {
+		return nil, fmt.Errorf("%w: sub: %+v", ErrMalformedToken, err)
+	}
+	if claims.ID, err = stringOrNumber(raw.JTI); err != nil {
+		return nil, fmt.Errorf("%w: jti: %+v", ErrMalformedToken, err)
+	}
+
+	return claims, nil
+}
+
+// Expired reports whether the token is expired. Tokens without exp never expire.
+func (c *TokenClaims) Expired() bool {
+	return !c.ExpiresAt.IsZero() && !time.Now().Before(c.ExpiresAt)
+}
+
+// ExpiresIn returns the time left until the token expires. It is negative for
+// expired tokens and zero if the token has no exp claim.
+func (c *TokenClaims) ExpiresIn() time.Duration {
+	if c.ExpiresAt.IsZero() {
+		return 0
+	}
+
+	return time.Until(c.ExpiresAt)
+}
+
+// TokenInfo returns the claims of the access_token of the current session
+func (a *API) TokenInfo() (*TokenClaims, error) {
+	token, _ := a.credentials()
+	if token == "" {
+		return nil, fmt.Errorf("%s", "there is no session yet")
+	}
+
+	return ParseToken(token)
+}
+
+// decodeSegment decodes a base64url segment with or without padding
+func decodeSegment(seg string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+}
+
+// numericDate converts a JWT NumericDate to time.Time
+func numericDate(n json.Number) (time.Time, error) {
+	if n == "" {
+		return time.Time{}, nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sec, frac := math.Modf(f)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+// stringList decodes a claim which is either a single string or a list of strings
+func stringList(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+
+	s, err := stringOrNumber(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{s}, nil
+}
+
+// stringOrNumber decodes a claim which should be a string but is sent as number by some issuers
+func stringOrNumber(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", err
+	}
+
+	return n.String(), nil
+}
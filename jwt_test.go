@@ -0,0 +1,143 @@
+package htbapi_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+// jwt builds an unsigned token with the given payload
+func jwt(payload string) string {
+	return strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"RS256"}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(payload)),
+		"signature",
+	}, ".")
+}
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  *htbapi.TokenClaims
+	}{
+		{
+			name:  "registered claims",
+			token: jwt(`{"aud":"1","exp":1700000000,"iat":1690000000,"nbf":1690000000,"jti":"abc","sub":"42"}`),
+			want: &htbapi.TokenClaims{
+				Audience:  []string{"1"},
+				ExpiresAt: time.Unix(1700000000, 0),
+				ID:        "abc",
+				IssuedAt:  time.Unix(1690000000, 0),
+				NotBefore: time.Unix(1690000000, 0),
+				Subject:   "42",
+			},
+		},
+		{
+			name:  "fractional dates and numeric subject",
+			token: jwt(`{"aud":["1","2"],"exp":1700000000.5,"sub":42}`),
+			want: &htbapi.TokenClaims{
+				Audience:  []string{"1", "2"},
+				ExpiresAt: time.Unix(1700000000, 5e8),
+				Subject:   "42",
+			},
+		},
+		{
+			name:  "padded payload",
+			token: jwt(`{"sub":"1"}`) + "==",
+			want:  &htbapi.TokenClaims{Subject: "1"},
+		},
+		{
+			name:  "no claims",
+			token: jwt(`{}`),
+			want:  &htbapi.TokenClaims{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := htbapi.ParseToken(tt.token)
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseToken = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTokenMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"two segments", "header.payload"},
+		{"four segments", jwt(`{}`) + ".extra"},
+		{"bad base64", "header.!!!.signature"},
+		{"bad json", jwt(`{"exp":`)},
+		{"payload no object", jwt(`"claims"`)},
+		{"bad exp", jwt(`{"exp":"tomorrow"}`)},
+		{"bad aud", jwt(`{"aud":{"id":1}}`)},
+		{"bad sub", jwt(`{"sub":true}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := htbapi.ParseToken(tt.token)
+			if !errors.Is(err, htbapi.ErrMalformedToken) {
+				t.Errorf("ParseToken error = %v, want ErrMalformedToken", err)
+			}
+		})
+	}
+}
+
+func TestTokenClaimsExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		expired   bool
+		// ExpiresIn is checked to lie in [minLeft, maxLeft]
+		minLeft, maxLeft time.Duration
+	}{
+		{"no exp", time.Time{}, false, 0, 0},
+		{"valid", time.Now().Add(time.Hour), false, 59 * time.Minute, time.Hour},
+		{"expired", time.Now().Add(-time.Hour), true, -61 * time.Minute, -59 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &htbapi.TokenClaims{ExpiresAt: tt.expiresAt}
+			if got := c.Expired(); got != tt.expired {
+				t.Errorf("Expired = %v, want %v", got, tt.expired)
+			}
+			if got := c.ExpiresIn(); got < tt.minLeft || got > tt.maxLeft {
+				t.Errorf("ExpiresIn = %v, want between %v and %v", got, tt.minLeft, tt.maxLeft)
+			}
+		})
+	}
+}
+
+func TestTokenInfo(t *testing.T) {
+	s := newTestServer(t)
+	a := newTestAPI(t, s)
+
+	if _, err := a.TokenInfo(); err == nil {
+		t.Error("TokenInfo without a session: want an error")
+	}
+
+	login(t, a)
+	claims, err := a.TokenInfo()
+	if err != nil {
+		t.Fatalf("TokenInfo: %v", err)
+	}
+	if claims.Expired() || claims.ExpiresIn() <= 0 {
+		t.Errorf("TokenInfo = %+v, want a valid token", claims)
+	}
+}
@@ -1 +1,48 @@
 package htbapi
+
+import (
+	"context"
+)
+
+// Ranking is an entry of the rankings of users, teams or countries
+type Ranking struct {
+	Rank          int    `json:"rank"`
+	RankChange    int    `json:"ranks_diff"`
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Avatar        string `json:"avatar"`
+	Country       string `json:"country"`
+	Points        int    `json:"points"`
+	UserOwns      int    `json:"user_owns"`
+	RootOwns      int    `json:"root_owns"`
+	ChallengeOwns int    `json:"challenge_owns"`
+	UserBloods    int    `json:"user_bloods"`
+	RootBloods    int    `json:"root_bloods"`
+	Fortress      int    `json:"fortress"`
+	Endgame       int    `json:"endgame"`
+}
+
+// RankingsService handles the hall of fame rankings
+type RankingsService service
+
+// Users returns an iterator over the ranking of users
+func (s *RankingsService) Users(ctx context.Context) *Iterator[Ranking] {
+	return s.rankings(ctx, "/rankings/users")
+}
+
+// Teams returns an iterator over the ranking of teams
+func (s *RankingsService) Teams(ctx context.Context) *Iterator[Ranking] {
+	return s.rankings(ctx, "/rankings/teams")
+}
+
+// Countries returns an iterator over the ranking of countries
+func (s *RankingsService) Countries(ctx context.Context) *Iterator[Ranking] {
+	return s.rankings(ctx, "/rankings/countries")
+}
+
+// rankings returns an iterator over the ranking served by endpoint
+func (s *RankingsService) rankings(ctx context.Context, endpoint string) *Iterator[Ranking] {
+	return NewIterator(ctx, func(ctx context.Context, page int) (Page[Ranking], error) {
+		return listPage[Ranking](ctx, s.api, endpoint, page)
+	})
+}
@@ -0,0 +1,121 @@
+package htbapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// expiryLayouts are the formats the api uses for expires_at
+var expiryLayouts = []string{"2006-01-02 15:04:05", time.RFC3339}
+
+// LifecycleResponse will be used to construct the response to the reset, extend and vote endpoints
+type LifecycleResponse struct {
+	Message     string `json:"message"`
+	ExpiresAt   string `json:"expires_at"`
+	Votes       int    `json:"votes"`
+	VotesNeeded int    `json:"votes_needed"`
+}
+
+// LifecycleResult is the outcome of Reset, Extend, VoteReset and AcceptResetVote.
+// An action refused because it was done too recently fails with an error matching ErrCooldown.
+type LifecycleResult struct {
+	Message string
+	// ExpiresAt is the time the machine will be stopped. It is zero if unknown.
+	ExpiresAt time.Time
+	// Votes and VotesNeeded tell the state of a reset vote on shared servers
+	Votes       int
+	VotesNeeded int
+}
+
+// Reset resets the running machine with id in arena to its initial state.
+// On shared servers a reset has to be voted for, see VoteReset.
+func (s *MachinesService) Reset(ctx context.Context, id int, arena Arena) (LifecycleResult, error) {
+	return s.lifecycle(ctx, id, arena, func(e arenaEndpoints) string { return e.reset })
+}
+
+// Extend extends the lifetime of the running machine with id in arena
+func (s *MachinesService) Extend(ctx context.Context, id int, arena Arena) (LifecycleResult, error) {
+	return s.lifecycle(ctx, id, arena, func(e arenaEndpoints) string { return e.extend })
+}
+
+// VoteReset starts a vote to reset the running machine with id in arena on a shared server
+func (s *MachinesService) VoteReset(ctx context.Context, id int, arena Arena) (LifecycleResult, error) {
+	return s.lifecycle(ctx, id, arena, func(e arenaEndpoints) string { return e.vote })
+}
+
+// AcceptResetVote agrees to the reset vote another player started for the machine with id in arena
+func (s *MachinesService) AcceptResetVote(ctx context.Context, id int, arena Arena) (LifecycleResult, error) {
+	return s.lifecycle(ctx, id, arena, func(e arenaEndpoints) string { return e.accept })
+}
+
+// lifecycle posts to the endpoint picked by endpoint and returns the result with the
+// new expiry. If the response lacks it, the expiry of the active machine is used.
+func (s *MachinesService) lifecycle(ctx context.Context, id int, arena Arena, endpoint func(arenaEndpoints) string) (LifecycleResult, error) {
+	e, err := arena.endpoints()
+	if err != nil {
+		return LifecycleResult{}, err
+	}
+
+	resp, err := Do[LifecycleResponse](ctx, s.api, http.MethodPost, endpoint(e), e.machineBody(id))
+	if err != nil {
+		return LifecycleResult{}, err
+	}
+
+	result := LifecycleResult{
+		Message:     resp.Message,
+		ExpiresAt:   parseExpiry(resp.ExpiresAt),
+		Votes:       resp.Votes,
+		VotesNeeded: resp.VotesNeeded,
+	}
+
+	if result.ExpiresAt.IsZero() {
+		// The action itself succeeded, so a failing lookup only leaves the expiry unknown
+		if info, err := Do[SpawnedMachineInfoResponse](ctx, s.api, http.MethodGet, e.active, nil); err == nil {
+			result.ExpiresAt = info.Info.Expiry()
+		}
+	}
+
+	return result, nil
+}
+
+// Expiry returns ExpiresAt of the machine or of its PlayInfo as time.
+// It is zero for machines which are not running.
+func (m *Machine) Expiry() time.Time {
+	if t := parseExpiry(m.ExpiresAt); !t.IsZero() {
+		return t
+	}
+
+	return parseExpiry(m.PlayInfo.ExpiresAt)
+}
+
+// parseExpiry parses an expires_at value of the api. Unknown formats yield the zero time.
+func parseExpiry(s string) time.Time {
+	for _, layout := range expiryLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Reset resets the machine instance in its arena, see MachinesService.Reset
+func (mi *MachineInstance) Reset(ctx context.Context, a *API) (LifecycleResult, error) {
+	return a.Machines.Reset(ctx, mi.Machine.ID, mi.Arena)
+}
+
+// Extend extends the lifetime of the machine instance, see MachinesService.Extend
+func (mi *MachineInstance) Extend(ctx context.Context, a *API) (LifecycleResult, error) {
+	return a.Machines.Extend(ctx, mi.Machine.ID, mi.Arena)
+}
+
+// VoteReset starts a vote to reset the machine instance, see MachinesService.VoteReset
+func (mi *MachineInstance) VoteReset(ctx context.Context, a *API) (LifecycleResult, error) {
+	return a.Machines.VoteReset(ctx, mi.Machine.ID, mi.Arena)
+}
+
+// AcceptResetVote agrees to a reset vote of the machine instance, see MachinesService.AcceptResetVote
+func (mi *MachineInstance) AcceptResetVote(ctx context.Context, a *API) (LifecycleResult, error) {
+	return a.Machines.AcceptResetVote(ctx, mi.Machine.ID, mi.Arena)
+}
@@ -0,0 +1,198 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// spawnedAPI returns a fake api with machine 1 spawned in arena and an API logged in to it
+func spawnedAPI(t *testing.T, arena htbapi.Arena) (*htbtest.Server, *htbapi.API) {
+	t.Helper()
+
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.SetReleaseArenaMachine(1)
+	a := newTestAPI(t, s)
+
+	if _, err := a.Machines.Spawn(context.Background(), 1, arena); err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+
+	return s, a
+}
+
+// near reports whether got is within a minute of want
+func near(got, want time.Time) bool {
+	d := got.Sub(want)
+	return d > -time.Minute && d < time.Minute
+}
+
+func TestLifecycle(t *testing.T) {
+	for _, arena := range []htbapi.Arena{htbapi.Lab, htbapi.ReleaseArena} {
+		t.Run(arena.String(), func(t *testing.T) {
+			_, a := spawnedAPI(t, arena)
+			ctx := context.Background()
+
+			r, err := a.Machines.Extend(ctx, 1, arena)
+			if err != nil {
+				t.Fatalf("Extend: %v", err)
+			}
+			if r.Message != "Machine extended." || !near(r.ExpiresAt, time.Now().Add(48*time.Hour)) {
+				t.Errorf("Extend = %+v, want the lifetime extended by a day", r)
+			}
+
+			r, err = a.Machines.Reset(ctx, 1, arena)
+			if err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if r.Message != "Lame will be reset in a few seconds." || r.ExpiresAt.IsZero() {
+				t.Errorf("Reset = %+v", r)
+			}
+
+			if _, err := a.Machines.AcceptResetVote(ctx, 1, arena); err == nil {
+				t.Error("AcceptResetVote without a vote: want an error")
+			}
+
+			r, err = a.Machines.VoteReset(ctx, 1, arena)
+			if err != nil {
+				t.Fatalf("VoteReset: %v", err)
+			}
+			if r.Message != "Reset vote started." || r.Votes != 0 || r.VotesNeeded != 1 {
+				t.Errorf("VoteReset = %+v", r)
+			}
+
+			_, err = a.Machines.VoteReset(ctx, 1, arena)
+			if err == nil || errors.Is(err, htbapi.ErrCooldown) {
+				t.Errorf("second VoteReset error = %v, want a running vote but no cooldown", err)
+			}
+
+			r, err = a.Machines.AcceptResetVote(ctx, 1, arena)
+			if err != nil {
+				t.Fatalf("AcceptResetVote: %v", err)
+			}
+			if r.Votes != 1 || r.VotesNeeded != 1 {
+				t.Errorf("AcceptResetVote = %+v, want the vote passed", r)
+			}
+		})
+	}
+}
+
+func TestLifecycleCooldown(t *testing.T) {
+	s, a := spawnedAPI(t, htbapi.Lab)
+	s.SetCooldown(time.Hour)
+	ctx := context.Background()
+
+	if _, err := a.Machines.Reset(ctx, 1, htbapi.Lab); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if _, err := a.Machines.Extend(ctx, 1, htbapi.Lab); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+
+	for name, action := range map[string]func(context.Context, int, htbapi.Arena) (htbapi.LifecycleResult, error){
+		"Reset":     a.Machines.Reset,
+		"Extend":    a.Machines.Extend,
+		"VoteReset": a.Machines.VoteReset,
+	} {
+		_, err := action(ctx, 1, htbapi.Lab)
+		if !errors.Is(err, htbapi.ErrCooldown) {
+			t.Errorf("%s error = %v, want ErrCooldown", name, err)
+		}
+		var apiErr *htbapi.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s error = %v, want an APIError with status 400", name, err)
+		}
+	}
+}
+
+func TestLifecycleNotRunning(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newTestAPI(t, s)
+
+	_, err := a.Machines.Extend(context.Background(), 1, htbapi.Lab)
+	if err == nil || errors.Is(err, htbapi.ErrCooldown) {
+		t.Errorf("Extend error = %v, want an error which is no cooldown", err)
+	}
+}
+
+func TestLifecycleExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want func(active time.Time) time.Time
+	}{
+		{
+			name: "api layout",
+			body: `{"message":"Machine extended.","expires_at":"2030-01-02 03:04:05"}`,
+			want: func(time.Time) time.Time { return time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC) },
+		},
+		{
+			name: "rfc3339",
+			body: `{"message":"Machine extended.","expires_at":"2030-01-02T03:04:05+02:00"}`,
+			want: func(time.Time) time.Time { return time.Date(2030, 1, 2, 1, 4, 5, 0, time.UTC) },
+		},
+		{
+			name: "missing falls back to the active machine",
+			body: `{"message":"Machine extended."}`,
+			want: func(active time.Time) time.Time { return active },
+		},
+		{
+			name: "unknown format falls back to the active machine",
+			body: `{"message":"Machine extended.","expires_at":"tomorrow"}`,
+			want: func(active time.Time) time.Time { return active },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, a := spawnedAPI(t, htbapi.Lab)
+			ctx := context.Background()
+
+			mi, err := a.Machines.Active(ctx, htbapi.Lab)
+			if err != nil {
+				t.Fatalf("Active: %v", err)
+			}
+			active := mi.Machine.Expiry()
+			if active.IsZero() {
+				t.Fatal("active machine has no expiry")
+			}
+
+			s.InjectFault(htbtest.Fault{PathPrefix: "/vm/extend", Status: http.StatusOK, Body: tt.body, Times: 1})
+			r, err := a.Machines.Extend(ctx, 1, htbapi.Lab)
+			if err != nil {
+				t.Fatalf("Extend: %v", err)
+			}
+			if want := tt.want(active); !r.ExpiresAt.Equal(want) {
+				t.Errorf("ExpiresAt = %v, want %v", r.ExpiresAt, want)
+			}
+		})
+	}
+}
+
+func TestMachineExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		m    htbapi.Machine
+		want time.Time
+	}{
+		{"none", htbapi.Machine{}, time.Time{}},
+		{"expires_at", htbapi.Machine{ExpiresAt: "2030-01-02 03:04:05"}, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"play info", htbapi.Machine{PlayInfo: htbapi.PlayInfo{ExpiresAt: "2030-01-02T03:04:05Z"}}, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"unknown format", htbapi.Machine{ExpiresAt: "02.01.2030"}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.Expiry(); !got.Equal(tt.want) {
+				t.Errorf("Expiry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package htbapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithLogger logs every request, retry and token refresh to l. Successful requests
+// are logged at debug level, failed ones at warn level. Bearer tokens, refresh
+// tokens, passwords, otp codes and flags are always redacted.
+// Nothing is logged by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(a *API) error {
+		a.logger = l
+		return nil
+	}
+}
+
+// logRequest logs the final result of a request
+func (a *API) logRequest(ctx context.Context, r *Request, attempt int, start time.Time, resp *http.Response, err error) {
+	if a.logger == nil {
+		return
+	}
+
+	level, attrs := requestAttrs(r.method, r.endpoint, time.Since(start), resp, err)
+	attrs = append(attrs, slog.Int("retries", attempt-1))
+	if len(r.query) > 0 {
+		attrs = append(attrs, slog.String("query", redactQuery(r.query.Encode())))
+	}
+	if r.body != nil && a.logger.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, slog.String("body", logBody(r.contentType, r.body)))
+	}
+
+	a.logger.LogAttrs(ctx, level, "htbapi request", attrs...)
+}
+
+// logRetry logs that a request will be retried after wait
+func (a *API) logRetry(ctx context.Context, r *Request, attempt int, wait time.Duration, resp *http.Response, err error) {
+	if a.logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.method),
+		slog.String("path", r.endpoint),
+		slog.Int("attempt", attempt),
+		slog.Duration("wait", wait),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", redactError(err)))
+	} else {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+
+	a.logger.LogAttrs(ctx, slog.LevelDebug, "htbapi retry", attrs...)
+}
+
+// logRefresh logs a token refresh and its result
+func (a *API) logRefresh(ctx context.Context, err error) {
+	if a.logger == nil {
+		return
+	}
+
+	if err != nil {
+		a.logger.LogAttrs(ctx, slog.LevelWarn, "htbapi token refresh failed", slog.String("error", redactError(err)))
+		return
+	}
+
+	attrs := []slog.Attr{}
+	if claims, err := ParseToken(a.sessionDetails().AccessToken); err == nil && !claims.ExpiresAt.IsZero() {
+		attrs = append(attrs, slog.Time("expires_at", claims.ExpiresAt))
+	}
+
+	a.logger.LogAttrs(ctx, slog.LevelInfo, "htbapi token refreshed", attrs...)
+}
+
+// requestAttrs returns the level and attributes logged for the result of a request.
+// They are shared by WithLogger and LoggingMiddleware.
+func requestAttrs(method, path string, latency time.Duration, resp *http.Response, err error) (slog.Level, []slog.Attr) {
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("path", path),
+		slog.Duration("latency", latency),
+	}
+
+	switch {
+	case err != nil:
+		return slog.LevelWarn, append(attrs, slog.String("error", redactError(err)))
+	case resp.StatusCode >= 400:
+		return slog.LevelWarn, append(attrs, slog.Int("status", resp.StatusCode))
+	default:
+		return slog.LevelDebug, append(attrs, slog.Int("status", resp.StatusCode))
+	}
+}
+
+// logBody describes a request body of contentType with all secrets redacted
+func logBody(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "application/json") {
+		return redactBody(body)
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return redactQuery(string(body))
+	}
+
+	return "<" + contentType + ">"
+}
@@ -0,0 +1,98 @@
+package htbapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// logRecords decodes the json lines written by a slog.JSONHandler
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("decoding %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+
+	return records
+}
+
+func TestLoggers(t *testing.T) {
+	s := newTestServer(t)
+
+	var logged, middleware bytes.Buffer
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	a := newTestAPI(t, s,
+		htbapi.WithLogger(slog.New(slog.NewJSONHandler(&logged, opts))),
+		htbapi.WithMiddleware(htbapi.LoggingMiddleware(slog.New(slog.NewJSONHandler(&middleware, opts)))),
+	)
+	login(t, a)
+
+	for name, buf := range map[string]*bytes.Buffer{"WithLogger": &logged, "LoggingMiddleware": &middleware} {
+		if strings.Contains(buf.String(), `password\":\"`+htbtest.DefaultPassword) {
+			t.Errorf("%s logged the password: %s", name, buf.String())
+		}
+
+		records := logRecords(t, buf)
+		if len(records) != 1 {
+			t.Fatalf("%s logged %d records, want 1", name, len(records))
+		}
+		r := records[0]
+		if r["msg"] != "htbapi request" || r["method"] != "POST" || r["path"] != "/login" || r["status"] != float64(200) {
+			t.Errorf("%s logged %v", name, r)
+		}
+		if _, ok := r["latency"]; !ok {
+			t.Errorf("%s logged no latency: %v", name, r)
+		}
+		if !strings.Contains(r["body"].(string), htbapi.Redacted) {
+			t.Errorf("%s logged body %v", name, r["body"])
+		}
+	}
+}
+
+func TestLoggersRedactErrorURL(t *testing.T) {
+	s := newTestServer(t)
+
+	var logged, middleware bytes.Buffer
+	a := newTestAPI(t, s,
+		htbapi.WithLogger(slog.New(slog.NewJSONHandler(&logged, nil))),
+		htbapi.WithMiddleware(htbapi.LoggingMiddleware(slog.New(slog.NewJSONHandler(&middleware, nil)))),
+	)
+	login(t, a)
+
+	s.InjectFault(htbtest.Fault{Method: http.MethodGet, PathPrefix: "/machine/profile", CloseConnection: true})
+	_, err := a.NewRequest(http.MethodGet, "/machine/profile/1").Query("token", "query-secret").Do(context.Background())
+	if err == nil {
+		t.Fatal("Do: want an error of the dropped connection")
+	}
+
+	for name, buf := range map[string]*bytes.Buffer{"WithLogger": &logged, "LoggingMiddleware": &middleware} {
+		if strings.Contains(buf.String(), "query-secret") {
+			t.Errorf("%s logged the query secret: %s", name, buf.String())
+		}
+
+		records := logRecords(t, buf)
+		if len(records) != 1 {
+			t.Fatalf("%s logged %d records, want 1", name, len(records))
+		}
+		msg, _ := records[0]["error"].(string)
+		if !strings.Contains(msg, "/machine/profile/1?token="+htbapi.Redacted) {
+			t.Errorf("%s logged error %q, want the redacted url", name, msg)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package htbapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"time"
 )
@@ -60,6 +63,11 @@ type MachineInstance struct {
 	IP      string
 	Machine Machine
 	Server  string
+	// Arena the machine was spawned in
+	Arena Arena
+	// IsSpawning and IsSpawned are the spawn state reported by the active endpoint
+	IsSpawning bool
+	IsSpawned  bool
 }
 
 // PlayInfo will represent data of an active machine
@@ -128,59 +136,42 @@ type SubmissionResponse struct {
 	Success string `json:"success"`
 }
 
-// GetAllMachines will get you a list of machines either active ones when choosing retired=false or
-// retired ones if choosing retired=true
-func (a *API) GetAllMachines(retired bool) ([]Machine, error) {
-	var endpoint string
-	switch retired {
-	case true:
+// MachinesService handles the machines in the lab and in release arena
+type MachinesService service
+
+// List returns the active machines or the retired ones if retired is true
+func (s *MachinesService) List(ctx context.Context, retired bool) ([]Machine, error) {
+	endpoint := "/machine/list"
+	if retired {
 		endpoint = "/machine/list/retired"
-	case false:
-		endpoint = "/machine/list"
-	default:
-		return nil, nil
 	}
 
-	body, _, err := a.DoRequest(endpoint, nil, true, false)
+	resp, err := Do[GetMachinesResponse](ctx, s.api, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer body.Close()
 
-	var respMessage GetMachinesResponse
-	if err := json.NewDecoder(body).Decode(&respMessage); err != nil {
-		return nil, err
-	}
-
-	return respMessage.Machines, nil
+	return resp.Machines, nil
 }
 
-// GetMachine will get you a machine by id
-func (a *API) GetMachine(id int) (Machine, error) {
-	sID := strconv.Itoa(id)
-
-	body, _, err := a.DoRequest(fmt.Sprintf("/machine/profile/%s", sID), nil, true, false)
+// Get returns the machine with id
+func (s *MachinesService) Get(ctx context.Context, id int) (Machine, error) {
+	resp, err := Do[GetMachineRepsonse](ctx, s.api, http.MethodGet, fmt.Sprintf("/machine/profile/%s", strconv.Itoa(id)), nil)
 	if err != nil {
 		return Machine{}, err
 	}
-	defer body.Close()
-
-	var respMessage GetMachineRepsonse
-	if err := json.NewDecoder(body).Decode(&respMessage); err != nil {
-		return Machine{}, err
-	}
 
-	return respMessage.Machine, nil
+	return resp.Machine, nil
 }
 
-// GetReleaseArenaMachine will get you the machine currently in release arena
-func (a *API) GetReleaseArenaMachine() (Machine, error) {
-	machines, err := a.GetAllMachines(false)
+// ReleaseArena returns the machine currently in release arena
+func (s *MachinesService) ReleaseArena(ctx context.Context) (Machine, error) {
+	machines, err := s.List(ctx, false)
 	if err != nil {
 		return Machine{}, err
 	}
 
-	raServer, err := a.GetCurrentVPNServer("release_arena")
+	raServer, err := s.api.VPN.Current(ctx, ReleaseArena.VPNEndpoint())
 	if err != nil {
 		return Machine{}, err
 	}
@@ -191,215 +182,316 @@ func (a *API) GetReleaseArenaMachine() (Machine, error) {
 		}
 	}
 
-	return Machine{}, fmt.Errorf("%s", "No release arena machine found")
+	return Machine{}, fmt.Errorf("no release arena machine found: %w", ErrNotFound)
 }
 
-// Spawn machine will spawn a machine and give you the machine instance.
-// You can choose if you want to spawn a release arena machine or a lab machine.
-func (m *Machine) SpawnMachine(a *API, releaseArena bool) (MachineInstance, error) {
-	switch releaseArena {
-	case true:
-		body, _, err := a.DoRequest("/release_arena/spawn", nil, true, true)
-		if err != nil {
-			return MachineInstance{}, err
-		}
-		defer body.Close()
+// machineIDBody is the json payload of requests only needing the machine id
+type machineIDBody struct {
+	MachineID int `json:"machine_id"`
+}
 
-		var resp SpawnMachineResponse
-		if err := json.NewDecoder(body).Decode(&resp); err != nil {
-			return MachineInstance{}, err
-		}
+// Spawn spawns the machine with id in arena and returns its instance. The id is
+// ignored in arenas holding only one machine like ReleaseArena. The machine is
+// usually still spawning and has no ip yet, use SpawnAndWait to wait for it.
+func (s *MachinesService) Spawn(ctx context.Context, id int, arena Arena) (MachineInstance, error) {
+	e, err := arena.endpoints()
+	if err != nil {
+		return MachineInstance{}, err
+	}
 
-		if resp.Success != 1 {
-			return MachineInstance{}, fmt.Errorf("cannot spawn machine in release arena: %s", resp.Message)
-		}
+	if err := s.spawn(ctx, id, e); err != nil {
+		return MachineInstance{}, err
+	}
 
-		mi, err := a.GetSpawnedMachineInstance(true)
-		if err != nil {
-			return MachineInstance{}, err
-		}
+	return s.Active(ctx, arena)
+}
 
-		return mi, nil
+// spawnState returns whether m is still spawning and whether it is spawned. A machine
+// reporting its play state has to be marked as spawned there as well.
+func spawnState(m Machine) (spawning, spawned bool) {
+	spawning = m.IsSpawning || m.PlayInfo.IsSpawning
+	spawned = m.ID != 0 && !spawning && (!m.PlayInfo.IsActive || m.PlayInfo.IsSpawend)
 
-	case false:
-		type jsonBody struct {
-			MachineID int `json:"machine_id"`
-		}
+	return spawning, spawned
+}
 
-		b := jsonBody{
-			MachineID: m.ID,
-		}
+// spawn sends the spawn request of the arena with endpoints e
+func (s *MachinesService) spawn(ctx context.Context, id int, e arenaEndpoints) error {
+	resp, err := Do[SpawnMachineResponse](ctx, s.api, http.MethodPost, e.spawn, e.machineBody(id))
+	if err != nil {
+		return err
+	}
 
-		j, err := json.Marshal(&b)
-		if err != nil {
-			return MachineInstance{}, err
+	if e.single && resp.Success != 1 {
+		return &APIError{
+			StatusCode: http.StatusOK,
+			Method:     http.MethodPost,
+			Endpoint:   e.spawn,
+			Message:    resp.Message,
 		}
+	}
 
-		resp, _, err := a.DoRequest("/vm/spawn", j, true, true)
-		if err != nil {
-			return MachineInstance{}, err
-		}
-		defer resp.Close()
+	return nil
+}
 
-		mi, err := a.GetSpawnedMachineInstance(false)
-		if err != nil {
-			return MachineInstance{}, err
-		}
+// Active returns the instance of the spawned machine in arena. Its state changes
+// while spawning, so all requests skip cached responses.
+func (s *MachinesService) Active(ctx context.Context, arena Arena) (MachineInstance, error) {
+	e, err := arena.endpoints()
+	if err != nil {
+		return MachineInstance{}, err
+	}
 
-		return mi, nil
+	ctx = withoutCache(ctx)
 
-	default:
+	info, err := Do[SpawnedMachineInfoResponse](ctx, s.api, http.MethodGet, e.active, nil)
+	if err != nil {
+		return MachineInstance{}, err
 	}
 
-	return MachineInstance{}, nil
+	// Grab current vpn server
+	server, err := s.api.VPN.Current(ctx, e.vpn)
+	if err != nil {
+		return MachineInstance{}, err
+	}
+
+	spawning, isSpawned := spawnState(info.Info)
+
+	if e.single {
+		return MachineInstance{
+			IP:         info.Info.IP,
+			Machine:    server.Machine,
+			Server:     server.AssignedServer.FriendlyName,
+			Arena:      arena,
+			IsSpawning: spawning,
+			IsSpawned:  isSpawned,
+		}, nil
+	}
+
+	ma, err := s.Get(ctx, info.Info.ID)
+	if err != nil {
+		return MachineInstance{}, err
+	}
+
+	// The profile may lag behind, so it has to agree that the machine is up
+	profileSpawning, profileSpawned := spawnState(ma)
+
+	return MachineInstance{
+		IP:         ma.IP,
+		Machine:    ma,
+		Server:     server.AssignedServer.FriendlyName,
+		Arena:      arena,
+		IsSpawning: spawning || profileSpawning,
+		IsSpawned:  isSpawned && profileSpawned,
+	}, nil
 }
 
-// GetSpawnedMachineInstance will return the Machine Instance of the spawned machine either in
-// release arena or in the lab.
-func (a *API) GetSpawnedMachineInstance(releaseArena bool) (MachineInstance, error) {
-	switch releaseArena {
-	case true:
-		mi := MachineInstance{}
-		infoBody, _, err := a.DoRequest("/release_arena/active", nil, true, false)
-		if err != nil {
-			return MachineInstance{}, err
-		}
-		defer infoBody.Close()
+// Stop stops the running machine with id in arena
+func (s *MachinesService) Stop(ctx context.Context, id int, arena Arena) error {
+	e, err := arena.endpoints()
+	if err != nil {
+		return err
+	}
 
-		var info SpawnedMachineInfoResponse
-		if err := json.NewDecoder(infoBody).Decode(&info); err != nil {
-			return MachineInstance{}, err
-		}
-		mi.IP = info.Info.IP
+	_, err = Do[SpawnMachineResponse](ctx, s.api, http.MethodPost, e.terminate, e.machineBody(id))
+	return err
+}
 
-		// Grab current vpn server
-		raServer, err := a.GetCurrentVPNServer("release_arena")
-		if err != nil {
-			return MachineInstance{}, err
-		}
-		mi.Server = raServer.AssignedServer.FriendlyName
-		mi.Machine = raServer.Machine
+// Submit submits a flag for the machine with id in arena. The difficulty rating goes from 1 to 10.
+// A wrong flag is reported as an *APIError matching ErrIncorrectFlag, the response then tells why.
+func (s *MachinesService) Submit(ctx context.Context, id int, flag string, difficulty int, arena Arena) (SubmissionResponse, error) {
+	sr := SubmissionResponse{}
+	if difficulty < 1 || difficulty > 10 {
+		return sr, fmt.Errorf("%s", "Difficulty has to be between 1 and 10")
+	}
 
-		return mi, nil
-	case false:
-		mi := MachineInstance{}
+	e, err := arena.endpoints()
+	if err != nil {
+		return sr, err
+	}
 
-		infoBody, _, err := a.DoRequest("/machine/active", nil, true, false)
-		if err != nil {
-			return MachineInstance{}, err
-		}
-		defer infoBody.Close()
+	return submitFlag(ctx, s.api, e.own, Submission{
+		ID:         id,
+		Flag:       flag,
+		Difficulty: difficulty * 10,
+	})
+}
 
-		var info SpawnedMachineInfoResponse
-		if err := json.NewDecoder(infoBody).Decode(&info); err != nil {
-			return MachineInstance{}, err
-		}
+// submitFlag posts a flag submission to endpoint. HTB answers some wrong flags with
+// status 200, so the body is checked as well and turned into an *APIError.
+func submitFlag(ctx context.Context, a *API, endpoint string, body interface{}) (SubmissionResponse, error) {
+	submissionResponse, err := Do[SubmissionResponse](ctx, a, http.MethodPost, endpoint, body)
 
-		ma, err := a.GetMachine(info.Info.ID)
-		if err != nil {
-			return MachineInstance{}, err
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// The error body has the same format and tells why the flag was rejected
+		json.Unmarshal(apiErr.Body, &submissionResponse)
+		return submissionResponse, err
+	}
+	if err != nil {
+		return SubmissionResponse{}, err
+	}
+
+	if submissionResponse.Status == http.StatusBadRequest || submissionResponse.Message == "Incorrect Flag!" {
+		return submissionResponse, &APIError{
+			StatusCode: http.StatusBadRequest,
+			Method:     http.MethodPost,
+			Endpoint:   endpoint,
+			Message:    submissionResponse.Message,
 		}
+	}
 
-		mi.IP = ma.IP
+	return submissionResponse, nil
+}
 
-		// Grab current vpn server
-		labServer, err := a.GetCurrentVPNServer("lab")
-		if err != nil {
-			return MachineInstance{}, err
-		}
-		mi.Server = labServer.AssignedServer.FriendlyName
-		mi.Machine = ma
+// GetAllMachines will get you a list of machines either active ones when choosing retired=false or
+// retired ones if choosing retired=true
+//
+// Deprecated: Use a.Machines.List.
+func (a *API) GetAllMachines(retired bool) ([]Machine, error) {
+	return a.Machines.List(context.Background(), retired)
+}
 
-		return mi, nil
+// GetAllMachinesContext is like GetAllMachines but uses ctx for the request.
+//
+// Deprecated: Use a.Machines.List.
+func (a *API) GetAllMachinesContext(ctx context.Context, retired bool) ([]Machine, error) {
+	return a.Machines.List(ctx, retired)
+}
 
-	default:
-	}
-	return MachineInstance{}, nil
+// GetMachine will get you a machine by id
+//
+// Deprecated: Use a.Machines.Get.
+func (a *API) GetMachine(id int) (Machine, error) {
+	return a.Machines.Get(context.Background(), id)
 }
 
-// Stop will stop the currently running machine instance
-func (mi *MachineInstance) Stop(a *API, releaseArena bool) (bool, error) {
-	switch releaseArena {
-	case true:
-		respBody, _, err := a.DoRequest("/release_arena/terminate", nil, true, true)
-		if err != nil {
-			return false, err
-		}
-		defer respBody.Close()
+// GetMachineContext is like GetMachine but uses ctx for the request.
+//
+// Deprecated: Use a.Machines.Get.
+func (a *API) GetMachineContext(ctx context.Context, id int) (Machine, error) {
+	return a.Machines.Get(ctx, id)
+}
 
-		var resp SpawnMachineResponse
-		if err := json.NewDecoder(respBody).Decode(&resp); err != nil {
-			return false, fmt.Errorf("did not terminate machine: %+v", resp.Message)
-		}
+// GetReleaseArenaMachine will get you the machine currently in release arena
+//
+// Deprecated: Use a.Machines.ReleaseArena.
+func (a *API) GetReleaseArenaMachine() (Machine, error) {
+	return a.Machines.ReleaseArena(context.Background())
+}
 
-	case false:
-		type jsonBody struct {
-			MachineID int `json:"machine_id"`
-		}
+// GetReleaseArenaMachineContext is like GetReleaseArenaMachine but uses ctx for the requests.
+//
+// Deprecated: Use a.Machines.ReleaseArena.
+func (a *API) GetReleaseArenaMachineContext(ctx context.Context) (Machine, error) {
+	return a.Machines.ReleaseArena(ctx)
+}
 
-		b := jsonBody{
-			MachineID: mi.Machine.ID,
-		}
+// Spawn machine will spawn a machine and give you the machine instance.
+// You can choose if you want to spawn a release arena machine or a lab machine.
+//
+// Deprecated: Use a.Machines.Spawn.
+func (m *Machine) SpawnMachine(a *API, releaseArena bool) (MachineInstance, error) {
+	return a.Machines.Spawn(context.Background(), m.ID, arenaOf(releaseArena))
+}
 
-		j, err := json.Marshal(&b)
-		if err != nil {
-			return false, err
-		}
+// SpawnMachineContext is like SpawnMachine but uses ctx for the requests.
+//
+// Deprecated: Use a.Machines.Spawn.
+func (m *Machine) SpawnMachineContext(ctx context.Context, a *API, releaseArena bool) (MachineInstance, error) {
+	return a.Machines.Spawn(ctx, m.ID, arenaOf(releaseArena))
+}
 
-		respBody, _, err := a.DoRequest("/vm/terminate", j, true, true)
-		if err != nil {
-			return false, err
-		}
-		defer respBody.Close()
+// SpawnMachine will spawn the machine with id and give you the machine instance.
+// The id is ignored in release arena as there is only one machine.
+//
+// Deprecated: Use a.Machines.Spawn.
+func (a *API) SpawnMachine(id int, releaseArena bool) (MachineInstance, error) {
+	return a.Machines.Spawn(context.Background(), id, arenaOf(releaseArena))
+}
 
-		return true, nil
+// SpawnMachineContext is like SpawnMachine but uses ctx for the requests.
+//
+// Deprecated: Use a.Machines.Spawn.
+func (a *API) SpawnMachineContext(ctx context.Context, id int, releaseArena bool) (MachineInstance, error) {
+	return a.Machines.Spawn(ctx, id, arenaOf(releaseArena))
+}
 
-	default:
-	}
+// GetSpawnedMachineInstance will return the Machine Instance of the spawned machine either in
+// release arena or in the lab.
+//
+// Deprecated: Use a.Machines.Active.
+func (a *API) GetSpawnedMachineInstance(releaseArena bool) (MachineInstance, error) {
+	return a.Machines.Active(context.Background(), arenaOf(releaseArena))
+}
 
-	return false, nil
+// GetSpawnedMachineInstanceContext is like GetSpawnedMachineInstance but uses ctx for the requests.
+//
+// Deprecated: Use a.Machines.Active.
+func (a *API) GetSpawnedMachineInstanceContext(ctx context.Context, releaseArena bool) (MachineInstance, error) {
+	return a.Machines.Active(ctx, arenaOf(releaseArena))
 }
 
-// Submit will submit a flag to the currently running machine instance. We will have to provide diffuculty from 1 to 10 and the flag and we need to either choose releaseArena true or false accordingly
-func (mi *MachineInstance) Submit(a *API, flag string, difficulty int, releaseArena bool) (bool, SubmissionResponse, error) {
-	sr := SubmissionResponse{}
-	if difficulty < 1 || difficulty > 10 {
-		return false, sr, fmt.Errorf("%s", "Difficulty has to be between 1 and 10")
-	}
+// Stop will stop the currently running machine instance
+//
+// Deprecated: Use a.Machines.Stop.
+func (mi *MachineInstance) Stop(a *API, releaseArena bool) (bool, error) {
+	return mi.StopContext(context.Background(), a, releaseArena)
+}
 
-	submission := Submission{
-		ID:         mi.Machine.ID,
-		Flag:       flag,
-		Difficulty: difficulty * 10,
+// StopContext is like Stop but uses ctx for the request.
+//
+// Deprecated: Use a.Machines.Stop.
+func (mi *MachineInstance) StopContext(ctx context.Context, a *API, releaseArena bool) (bool, error) {
+	if err := a.Machines.Stop(ctx, mi.Machine.ID, arenaOf(releaseArena)); err != nil {
+		return false, err
 	}
 
-	jsonData, err := json.Marshal(submission)
-	if err != nil {
-		return false, sr, err
-	}
+	return true, nil
+}
 
-	var endpoint string
-	switch releaseArena {
-	case true:
-		endpoint = "/release_arena/own"
-	case false:
-		endpoint = "/machine/own"
-	}
+// StopMachine will stop the running machine with id
+//
+// Deprecated: Use a.Machines.Stop.
+func (a *API) StopMachine(id int, releaseArena bool) error {
+	return a.Machines.Stop(context.Background(), id, arenaOf(releaseArena))
+}
 
-	resp, code, err := a.DoRequest(endpoint, jsonData, true, true)
-	if err != nil {
-		return false, sr, err
-	}
-	defer resp.Close()
+// StopMachineContext is like StopMachine but uses ctx for the request.
+//
+// Deprecated: Use a.Machines.Stop.
+func (a *API) StopMachineContext(ctx context.Context, id int, releaseArena bool) error {
+	return a.Machines.Stop(ctx, id, arenaOf(releaseArena))
+}
 
-	var submissionResponse SubmissionResponse
-	if err := json.NewDecoder(resp).Decode(&submissionResponse); err != nil {
-		return false, sr, err
-	}
+// Submit will submit a flag to the currently running machine instance. We will have to provide diffuculty from 1 to 10 and the flag and we need to either choose releaseArena true or false accordingly
+// A wrong flag is reported as an *APIError matching ErrIncorrectFlag.
+//
+// Deprecated: Use a.Machines.Submit.
+func (mi *MachineInstance) Submit(a *API, flag string, difficulty int, releaseArena bool) (bool, SubmissionResponse, error) {
+	return mi.SubmitContext(context.Background(), a, flag, difficulty, releaseArena)
+}
 
-	if code == 400 || submissionResponse.Status == 400 || submissionResponse.Message == "Incorrect Flag!" {
-		return false, submissionResponse, nil
-	}
+// SubmitContext is like Submit but uses ctx for the request.
+//
+// Deprecated: Use a.Machines.Submit.
+func (mi *MachineInstance) SubmitContext(ctx context.Context, a *API, flag string, difficulty int, releaseArena bool) (bool, SubmissionResponse, error) {
+	sr, err := a.Machines.Submit(ctx, mi.Machine.ID, flag, difficulty, arenaOf(releaseArena))
+
+	return err == nil, sr, err
+}
+
+// SubmitFlag will submit a flag for the machine with id. The difficulty rating goes from 1 to 10.
+// A wrong flag is reported as an *APIError matching ErrIncorrectFlag, the response then tells why.
+//
+// Deprecated: Use a.Machines.Submit.
+func (a *API) SubmitFlag(id int, flag string, difficulty int, releaseArena bool) (SubmissionResponse, error) {
+	return a.Machines.Submit(context.Background(), id, flag, difficulty, arenaOf(releaseArena))
+}
 
-	return true, submissionResponse, nil
+// SubmitFlagContext is like SubmitFlag but uses ctx for the request.
+//
+// Deprecated: Use a.Machines.Submit.
+func (a *API) SubmitFlagContext(ctx context.Context, id int, flag string, difficulty int, releaseArena bool) (SubmissionResponse, error) {
+	return a.Machines.Submit(ctx, id, flag, difficulty, arenaOf(releaseArena))
 }
@@ -0,0 +1,227 @@
+package htbapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPerPage is the page size of queries without PerPage
+const DefaultPerPage = 100
+
+// MachineSort is the order of machines returned by a MachineQuery
+type MachineSort string
+
+const (
+	// SortByRelease orders by release date
+	SortByRelease MachineSort = "release-date"
+	// SortByName orders by name
+	SortByName MachineSort = "name"
+	// SortByDifficulty orders by difficulty rating
+	SortByDifficulty MachineSort = "difficulty"
+	// SortByUserOwns orders by number of user owns
+	SortByUserOwns MachineSort = "user-owns"
+	// SortByRootOwns orders by number of root owns
+	SortByRootOwns MachineSort = "root-owns"
+)
+
+// MachineQuery filters, sorts and searches machines, see MachinesService.Query.
+// Zero fields do not filter.
+type MachineQuery struct {
+	// Retired queries the retired machines instead of the active ones
+	Retired bool
+	// OS matches any of the operating systems, e.g. "Linux"
+	OS []string
+	// Difficulty matches any of the difficulties, e.g. "Easy"
+	Difficulty []string
+	// Free, Owned and Todo match machines which are free to play, owned by user
+	// and root, or on the todo list. Use Bool to set them.
+	Free  *bool
+	Owned *bool
+	Todo  *bool
+	// Tags matches machines having all tags. They are only filtered by the api, so
+	// queries with tags fail if the paginated list is not available.
+	Tags []string
+	// Keyword matches machines whose name contains it
+	Keyword string
+	// SortBy and Descending order the machines. Empty SortBy keeps the order of the api.
+	SortBy     MachineSort
+	Descending bool
+	// PerPage is the page size, it defaults to DefaultPerPage
+	PerPage int
+}
+
+// Bool returns a pointer to b, e.g. for MachineQuery.Free
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Query returns an iterator over the machines matching q. The pages are filtered and
+// sorted by the api if it supports the paginated list endpoints. Otherwise the whole
+// list is fetched and filtered locally, which fails for queries with Tags.
+func (s *MachinesService) Query(ctx context.Context, q MachineQuery) *Iterator[Machine] {
+	return NewIterator(ctx, func(ctx context.Context, page int) (Page[Machine], error) {
+		p, err := Fetch[Page[Machine]](ctx, q.request(s.api, page))
+		if errors.Is(err, ErrNotFound) && page == 1 {
+			if len(q.Tags) > 0 {
+				// Machines of the plain list carry no tags to filter by
+				return p, fmt.Errorf("cannot filter by tags without the paginated machine list: %w", err)
+			}
+			return s.queryList(ctx, q)
+		}
+		if err != nil {
+			return p, err
+		}
+
+		p.Data = q.filter(p.Data)
+		return p, nil
+	})
+}
+
+// queryList filters and sorts the whole machine list for apis without pagination
+func (s *MachinesService) queryList(ctx context.Context, q MachineQuery) (Page[Machine], error) {
+	machines, err := s.List(ctx, q.Retired)
+	if err != nil {
+		return Page[Machine]{}, err
+	}
+
+	machines = q.filter(machines)
+	q.sort(machines)
+
+	return Page[Machine]{Data: machines}, nil
+}
+
+// request builds the request of page with all filters the api supports
+func (q MachineQuery) request(a *API, page int) *Request {
+	endpoint := "/machine/paginated"
+	if q.Retired {
+		endpoint = "/machine/list/retired/paginated"
+	}
+
+	perPage := q.PerPage
+	if perPage <= 0 {
+		perPage = DefaultPerPage
+	}
+
+	r := a.NewRequest(http.MethodGet, endpoint).
+		Query("page", strconv.Itoa(page)).
+		Query("per_page", strconv.Itoa(perPage))
+
+	for _, os := range q.OS {
+		r.Query("os[]", strings.ToLower(os))
+	}
+	for _, d := range q.Difficulty {
+		r.Query("difficulty[]", strings.ToLower(d))
+	}
+	for _, tag := range q.Tags {
+		r.Query("tags[]", tag)
+	}
+	if q.Free != nil {
+		r.Query("free", boolParam(*q.Free))
+	}
+	if q.Owned != nil {
+		r.Query("owned", boolParam(*q.Owned))
+	}
+	if q.Todo != nil {
+		r.Query("todo", boolParam(*q.Todo))
+	}
+	if q.Keyword != "" {
+		r.Query("keyword", q.Keyword)
+	}
+	if q.SortBy != "" {
+		sortType := "asc"
+		if q.Descending {
+			sortType = "desc"
+		}
+		r.Query("sort_by", string(q.SortBy)).Query("sort_type", sortType)
+	}
+
+	return r
+}
+
+// boolParam formats b as query parameter
+func boolParam(b bool) string {
+	if b {
+		return "1"
+	}
+
+	return "0"
+}
+
+// filter returns the machines matching q. It is applied to the pages of the api
+// as well in case it ignored some filters.
+func (q MachineQuery) filter(machines []Machine) []Machine {
+	matching := machines[:0]
+	for _, m := range machines {
+		if q.match(&m) {
+			matching = append(matching, m)
+		}
+	}
+
+	return matching
+}
+
+// match reports whether m matches all filters but Tags
+func (q MachineQuery) match(m *Machine) bool {
+	if len(q.OS) > 0 && !containsFold(q.OS, m.OS) {
+		return false
+	}
+	if len(q.Difficulty) > 0 && !containsFold(q.Difficulty, m.DifficultyText) {
+		return false
+	}
+	if q.Free != nil && m.Free != *q.Free {
+		return false
+	}
+	if q.Owned != nil && (m.IsCompleted || m.AuthUserInUserOwns && m.AuthUserInRootOwns) != *q.Owned {
+		return false
+	}
+	if q.Todo != nil && m.IsTodo != *q.Todo {
+		return false
+	}
+	if q.Keyword != "" && !strings.Contains(strings.ToLower(m.Name), strings.ToLower(q.Keyword)) {
+		return false
+	}
+
+	return true
+}
+
+// sort orders machines by q.SortBy
+func (q MachineQuery) sort(machines []Machine) {
+	var less func(a, b *Machine) bool
+	switch q.SortBy {
+	case SortByRelease:
+		less = func(a, b *Machine) bool { return a.Release.Before(b.Release) }
+	case SortByName:
+		less = func(a, b *Machine) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case SortByDifficulty:
+		less = func(a, b *Machine) bool { return a.Difficulty < b.Difficulty }
+	case SortByUserOwns:
+		less = func(a, b *Machine) bool { return a.UserOwnsCount < b.UserOwnsCount }
+	case SortByRootOwns:
+		less = func(a, b *Machine) bool { return a.RootOwnsCount < b.RootOwnsCount }
+	default:
+		return
+	}
+
+	sort.SliceStable(machines, func(i, j int) bool {
+		if q.Descending {
+			return less(&machines[j], &machines[i])
+		}
+		return less(&machines[i], &machines[j])
+	})
+}
+
+// containsFold reports whether list contains s ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,163 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// newQueryServer returns a fake api with a mix of machines
+func newQueryServer(t *testing.T) *htbtest.Server {
+	t.Helper()
+
+	s := newTestServer(t)
+	for _, m := range []htbapi.Machine{
+		{ID: 1, Name: "Lame", OS: "Linux", DifficultyText: "Easy", Free: true},
+		{ID: 2, Name: "Legacy", OS: "Windows", DifficultyText: "Easy"},
+		{ID: 3, Name: "Bastion", OS: "Windows", DifficultyText: "Medium", Free: true},
+		{ID: 4, Name: "Blue", OS: "Windows", DifficultyText: "Easy", Retired: 1},
+		{ID: 5, Name: "Jerry", OS: "Windows", DifficultyText: "Easy"},
+	} {
+		s.AddMachine(m, "user", "root")
+	}
+
+	return s
+}
+
+// names returns the names of machines
+func names(machines []htbapi.Machine) []string {
+	list := []string{}
+	for _, m := range machines {
+		list = append(list, m.Name)
+	}
+
+	return list
+}
+
+// queries returns the query parameters of all requests s received for path
+func queries(s *htbtest.Server, path string) []url.Values {
+	var list []url.Values
+	for _, r := range s.Requests() {
+		if r.Method == http.MethodGet && r.Path == path {
+			list = append(list, r.Query)
+		}
+	}
+
+	return list
+}
+
+// windowsQuery matches the active easy windows machines which are not free
+var windowsQuery = htbapi.MachineQuery{
+	OS:         []string{"Windows"},
+	Difficulty: []string{"Easy"},
+	Free:       htbapi.Bool(false),
+	Keyword:    "e",
+	SortBy:     htbapi.SortByName,
+	Descending: true,
+	PerPage:    1,
+}
+
+func TestMachineQuery(t *testing.T) {
+	s := newQueryServer(t)
+	a := newTestAPI(t, s)
+
+	q := windowsQuery
+	q.Tags = []string{"Web"}
+	machines, err := a.Machines.Query(context.Background(), q).All()
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got, want := names(machines), []string{"Legacy", "Jerry"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Query = %v, want %v", got, want)
+	}
+
+	requests := queries(s, "/machine/paginated")
+	if len(requests) != 2 {
+		t.Fatalf("%d page requests, want 2", len(requests))
+	}
+	want := url.Values{
+		"page":         {"1"},
+		"per_page":     {"1"},
+		"os[]":         {"windows"},
+		"difficulty[]": {"easy"},
+		"tags[]":       {"Web"},
+		"free":         {"0"},
+		"keyword":      {"e"},
+		"sort_by":      {"name"},
+		"sort_type":    {"desc"},
+	}
+	if !reflect.DeepEqual(requests[0], want) {
+		t.Errorf("query parameters = %v, want %v", requests[0], want)
+	}
+	if page := requests[1].Get("page"); page != "2" {
+		t.Errorf("second request asked for page %s, want 2", page)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/list"); n != 0 {
+		t.Errorf("%d requests of the plain list, want 0", n)
+	}
+}
+
+func TestMachineQueryRetired(t *testing.T) {
+	s := newQueryServer(t)
+	a := newTestAPI(t, s)
+
+	machines, err := a.Machines.Query(context.Background(), htbapi.MachineQuery{Retired: true}).All()
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got, want := names(machines), []string{"Blue"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Query = %v, want %v", got, want)
+	}
+
+	requests := queries(s, "/machine/list/retired/paginated")
+	if len(requests) != 1 || requests[0].Get("per_page") != "100" {
+		t.Errorf("requests = %v, want one page of DefaultPerPage", requests)
+	}
+}
+
+func TestMachineQueryFallback(t *testing.T) {
+	s := newQueryServer(t)
+	s.InjectFault(htbtest.Fault{
+		Method:     http.MethodGet,
+		PathPrefix: "/machine/paginated",
+		Status:     http.StatusNotFound,
+		Body:       `{"message":"Not Found"}`,
+	})
+	a := newTestAPI(t, s)
+
+	machines, err := a.Machines.Query(context.Background(), windowsQuery).All()
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got, want := names(machines), []string{"Legacy", "Jerry"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Query = %v, want %v filtered and sorted locally", got, want)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/list"); n != 1 {
+		t.Errorf("%d requests of the plain list, want 1", n)
+	}
+}
+
+func TestMachineQueryTagsWithoutPagination(t *testing.T) {
+	s := newQueryServer(t)
+	s.InjectFault(htbtest.Fault{
+		Method:     http.MethodGet,
+		PathPrefix: "/machine/paginated",
+		Status:     http.StatusNotFound,
+		Body:       `{"message":"Not Found"}`,
+	})
+	a := newTestAPI(t, s)
+
+	_, err := a.Machines.Query(context.Background(), htbapi.MachineQuery{Tags: []string{"Web"}}).All()
+	if !errors.Is(err, htbapi.ErrNotFound) {
+		t.Errorf("Query error = %v, want ErrNotFound", err)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/list"); n != 0 {
+		t.Errorf("%d requests of the plain list, want 0", n)
+	}
+}
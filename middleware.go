@@ -0,0 +1,346 @@
+package htbapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redacted replaces secrets in logs
+const Redacted = "REDACTED"
+
+// secretFields are json fields and query parameters whose values are never logged
+var secretFields = map[string]bool{
+	"access_token":      true,
+	"flag":              true,
+	"one_time_password": true,
+	"password":          true,
+	"refresh_token":     true,
+	"token":             true,
+}
+
+// Doer sends a http request. *http.Client implements it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc is a function implementing Doer
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do implements Doer
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer sending a request. It is called for every attempt,
+// so a retried request passes it more than once.
+type Middleware func(next Doer) Doer
+
+// hooks holds the callbacks registered with the On methods
+type hooks struct {
+	request      []func(req *http.Request)
+	response     []func(resp *http.Response)
+	retry        []func(method, endpoint string, attempt int, wait time.Duration)
+	tokenRefresh []func(t *Token)
+	err          []func(method, endpoint string, err error)
+}
+
+// endpointKey is the context key of the api endpoint of a request
+type endpointKey struct{}
+
+// WithMiddleware adds middleware to the API, see Use
+func WithMiddleware(mw ...Middleware) Option {
+	return func(a *API) error {
+		a.Use(mw...)
+		return nil
+	}
+}
+
+// Use adds middleware around every request sent to the api. The first middleware
+// added is the outermost one.
+func (a *API) Use(mw ...Middleware) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.middleware = append(a.middleware, mw...)
+}
+
+// OnRequest registers fn to be called before every attempt of a request is sent.
+// fn may modify the request, e.g. add headers.
+func (a *API) OnRequest(fn func(req *http.Request)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks.request = append(a.hooks.request, fn)
+}
+
+// OnResponse registers fn to be called with every response received.
+// fn must not consume the body.
+func (a *API) OnResponse(fn func(resp *http.Response)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks.response = append(a.hooks.response, fn)
+}
+
+// OnRetry registers fn to be called whenever attempt of a request failed and
+// it will be sent again after wait
+func (a *API) OnRetry(fn func(method, endpoint string, attempt int, wait time.Duration)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks.retry = append(a.hooks.retry, fn)
+}
+
+// OnTokenRefresh registers fn to be called after the session was refreshed
+func (a *API) OnTokenRefresh(fn func(t *Token)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks.tokenRefresh = append(a.hooks.tokenRefresh, fn)
+}
+
+// OnError registers fn to be called whenever a request to endpoint fails,
+// including error responses of the api
+func (a *API) OnError(fn func(method, endpoint string, err error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks.err = append(a.hooks.err, fn)
+}
+
+// Endpoint returns the api endpoint of a request sent by the API, e.g. "/machine/list".
+// It is meant for middleware and returns the url path for other requests.
+func Endpoint(req *http.Request) string {
+	if endpoint, ok := req.Context().Value(endpointKey{}).(string); ok {
+		return endpoint
+	}
+
+	return req.URL.Path
+}
+
+// chain returns the Doer sending a request through all middleware
+func (a *API) chain() Doer {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	h := a.hooks
+	session := a.Session
+
+	var d Doer = DoerFunc(func(req *http.Request) (*http.Response, error) {
+		for _, fn := range h.request {
+			fn(req)
+		}
+
+		resp, err := session.Do(req)
+		if err != nil {
+			return resp, err
+		}
+
+		for _, fn := range h.response {
+			fn(resp)
+		}
+
+		return resp, nil
+	})
+
+	for i := len(a.middleware) - 1; i >= 0; i-- {
+		d = a.middleware[i](d)
+	}
+
+	return d
+}
+
+// fireError calls all OnError hooks
+func (a *API) fireError(method, endpoint string, err error) {
+	a.mu.RLock()
+	fns := a.hooks.err
+	a.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(method, endpoint, err)
+	}
+}
+
+// fireRetry calls all OnRetry hooks
+func (a *API) fireRetry(method, endpoint string, attempt int, wait time.Duration) {
+	a.mu.RLock()
+	fns := a.hooks.retry
+	a.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(method, endpoint, attempt, wait)
+	}
+}
+
+// fireTokenRefresh calls all OnTokenRefresh hooks with the current session
+func (a *API) fireTokenRefresh() {
+	a.mu.RLock()
+	fns := a.hooks.tokenRefresh
+	t := newToken(a.Token, a.RefreshToken)
+	a.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(t)
+	}
+}
+
+// LoggingMiddleware logs every attempt of a request to logger with the same attributes
+// as WithLogger: method, path, latency and status or error, plus query and body with
+// all secrets redacted. If logger is nil the default logger of slog is used.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+
+			ctx := req.Context()
+			level, attrs := requestAttrs(req.Method, Endpoint(req), time.Since(start), resp, err)
+			if req.URL.RawQuery != "" {
+				attrs = append(attrs, slog.String("query", redactQuery(req.URL.RawQuery)))
+			}
+			if logger.Enabled(ctx, slog.LevelDebug) {
+				if body := requestBody(req); body != nil {
+					attrs = append(attrs, slog.String("body", logBody(req.Header.Get("Content-Type"), body)))
+				}
+			}
+
+			logger.LogAttrs(ctx, level, "htbapi request", attrs...)
+
+			return resp, err
+		})
+	}
+}
+
+// TimingMiddleware calls record with the duration of every request. status is 0 if
+// no response was received.
+func TimingMiddleware(record func(method, endpoint string, status int, d time.Duration)) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			record(req.Method, Endpoint(req), status, time.Since(start))
+
+			return resp, err
+		})
+	}
+}
+
+// redactQuery returns the url encoded values with all secret values replaced
+func redactQuery(raw string) string {
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return Redacted
+	}
+
+	for k := range q {
+		if secretFields[strings.ToLower(k)] {
+			q.Set(k, Redacted)
+		}
+	}
+
+	return q.Encode()
+}
+
+// redactError returns the message of err. If err wraps a *url.Error the secret
+// query parameters of its url are replaced, as the message contains the whole url.
+func redactError(err error) string {
+	msg := err.Error()
+
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return msg
+	}
+
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return strings.ReplaceAll(msg, urlErr.URL, Redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactQuery(u.RawQuery)
+	}
+	redacted := u.Redacted()
+
+	// url.Error quotes the url, which escapes some characters
+	msg = strings.ReplaceAll(msg, strconv.Quote(urlErr.URL), strconv.Quote(redacted))
+	return strings.ReplaceAll(msg, urlErr.URL, redacted)
+}
+
+// redactBody returns a json body with the values of all secret fields replaced.
+// Bodies which are no json are only described by their size.
+func redactBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	return string(data)
+}
+
+// redactValue walks v and replaces the secret fields of all objects
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if secretFields[strings.ToLower(k)] {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+	}
+
+	return v
+}
+
+// requestBody returns a copy of the body of req without consuming it
+func requestBody(req *http.Request) []byte {
+	if req.GetBody == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	return bytes.TrimSpace(data)
+}
+
+// withEndpoint stores the api endpoint in ctx, see Endpoint
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
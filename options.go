@@ -0,0 +1,163 @@
+package htbapi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option configures an API while it is created by New
+type Option func(*API) error
+
+// WithCredentials sets the email and password used by Login and whether the
+// session should be remembered. Empty values will be prompted for on login.
+func WithCredentials(username, password string, remember bool) Option {
+	return func(a *API) error {
+		a.Username = username
+		a.Password = password
+		a.Remember = remember
+		return nil
+	}
+}
+
+// WithBaseURL sets the api endpoint all requests are sent to.
+// It defaults to DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(a *API) error {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid base url: %s", baseURL)
+		}
+
+		a.BaseURL = strings.TrimSuffix(u.String(), "/")
+		return nil
+	}
+}
+
+// WithHTTPClient replaces the http client used for all requests. A copy of c is
+// used, so c itself is never modified. If it has no cookie jar a new one will be
+// attached. Its timeout is kept unless WithTimeout is given. Options modifying
+// the transport have to be given after this one.
+func WithHTTPClient(c *http.Client) Option {
+	return func(a *API) error {
+		if c == nil {
+			return fmt.Errorf("%s", "http client must not be nil")
+		}
+
+		session := *c
+		if session.Jar == nil {
+			jar, err := cookiejar.New(&cookiejar.Options{})
+			if err != nil {
+				return err
+			}
+			session.Jar = jar
+		}
+
+		a.Session = &session
+		return nil
+	}
+}
+
+// WithProxy routes all requests through the proxy at proxyURL.
+func WithProxy(proxyURL string) Option {
+	return func(a *API) error {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+
+		t, err := a.transport()
+		if err != nil {
+			return err
+		}
+		t.Proxy = http.ProxyURL(proxy)
+
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls configuration used by the transport.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(a *API) error {
+		t, err := a.transport()
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig = cfg
+
+		return nil
+	}
+}
+
+// WithTimeout sets the overall timeout of a single http request.
+// A timeout of zero means no timeout. It also applies to the client of
+// WithHTTPClient, no matter in which order both are given.
+func WithTimeout(d time.Duration) Option {
+	return func(a *API) error {
+		if d < 0 {
+			return fmt.Errorf("invalid timeout: %s", d)
+		}
+
+		a.timeout = &d
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(a *API) error {
+		a.userAgent = ua
+		return nil
+	}
+}
+
+// WithDebugFromEnv enables the debug mode if DEBUG=TRUE is present in env.
+// All traffic will then go through DefaultDebugProxy and the certificate
+// of the server will not be verified. Never use this in production.
+func WithDebugFromEnv() Option {
+	return func(a *API) error {
+		if os.Getenv("DEBUG") != "TRUE" {
+			return nil
+		}
+
+		if err := WithProxy(DefaultDebugProxy)(a); err != nil {
+			return err
+		}
+
+		return WithTLSConfig(&tls.Config{
+			InsecureSkipVerify: true,
+		})(a)
+	}
+}
+
+// transport returns the *http.Transport of the session so options can modify it.
+// A transport not created by the API, e.g. http.DefaultTransport of a client given
+// to WithHTTPClient, is cloned first so changes never leak to other clients.
+func (a *API) transport() (*http.Transport, error) {
+	if a.ownTransport != nil && a.Session.Transport == a.ownTransport {
+		return a.ownTransport, nil
+	}
+
+	var t *http.Transport
+	switch rt := a.Session.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		return nil, fmt.Errorf("cannot configure transport of type %T", a.Session.Transport)
+	}
+
+	a.Session.Transport = t
+	a.ownTransport = t
+
+	return t, nil
+}
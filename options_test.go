@@ -0,0 +1,45 @@
+package htbapi_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+func TestTimeout(t *testing.T) {
+	client := &http.Client{Timeout: 7 * time.Second}
+
+	tests := []struct {
+		name string
+		opts []htbapi.Option
+		want time.Duration
+	}{
+		{"default", nil, 45 * time.Second},
+		{"WithTimeout", []htbapi.Option{htbapi.WithTimeout(5 * time.Second)}, 5 * time.Second},
+		{"timeout of the client", []htbapi.Option{htbapi.WithHTTPClient(client)}, 7 * time.Second},
+		{"WithTimeout before WithHTTPClient", []htbapi.Option{htbapi.WithTimeout(5 * time.Second), htbapi.WithHTTPClient(client)}, 5 * time.Second},
+		{"WithTimeout after WithHTTPClient", []htbapi.Option{htbapi.WithHTTPClient(client), htbapi.WithTimeout(5 * time.Second)}, 5 * time.Second},
+		{"no timeout", []htbapi.Option{htbapi.WithHTTPClient(client), htbapi.WithTimeout(0)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := htbapi.New(tt.opts...)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if a.Session.Timeout != tt.want {
+				t.Errorf("timeout = %v, want %v", a.Session.Timeout, tt.want)
+			}
+		})
+	}
+
+	if client.Timeout != 7*time.Second {
+		t.Errorf("WithTimeout modified the given client: timeout = %v", client.Timeout)
+	}
+	if _, err := htbapi.New(htbapi.WithTimeout(-time.Second)); err == nil {
+		t.Error("New with negative timeout: want an error")
+	}
+}
@@ -0,0 +1,20 @@
+module github.com/patrickhener/go-htbapi/otelhtbapi
+
+go 1.21
+
+require (
+	github.com/patrickhener/go-htbapi v0.0.0-20261017124210-77aae6a9b844
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/metric v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/sdk/metric v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/term v0.13.0 // indirect
+)
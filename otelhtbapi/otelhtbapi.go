@@ -0,0 +1,229 @@
+// Package otelhtbapi instruments a htbapi.API with OpenTelemetry. Every request
+// sent to the api gets a client span and is counted in metrics for requests,
+// errors, retries and token refreshes. It is a module of its own, so only users of
+// the instrumentation depend on OpenTelemetry. It requires a released version of the
+// api client; to work on both at once use a go.work which is not committed:
+//
+//	go work init . ./otelhtbapi
+package otelhtbapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+// ScopeName is the instrumentation scope of the tracer and meter
+const ScopeName = "github.com/patrickhener/go-htbapi/otelhtbapi"
+
+// Attribute keys set on spans and metrics
+const (
+	MethodKey     = attribute.Key("http.request.method")
+	StatusCodeKey = attribute.Key("http.response.status_code")
+	TemplateKey   = attribute.Key("url.template")
+	ErrorTypeKey  = attribute.Key("error.type")
+	ServerKey     = attribute.Key("server.address")
+)
+
+// config holds the providers used by Instrument
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagators    propagation.TextMapPropagator
+}
+
+// Option configures Instrument
+type Option func(*config)
+
+// WithTracerProvider sets the TracerProvider. It defaults to the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets the MeterProvider. It defaults to the global one.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = mp
+	}
+}
+
+// WithPropagators sets the propagators injecting the trace context into requests.
+// It defaults to the global ones.
+func WithPropagators(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = p
+	}
+}
+
+// instrumentation holds the tracer and all instruments
+type instrumentation struct {
+	tracer      trace.Tracer
+	propagators propagation.TextMapPropagator
+
+	requests       metric.Int64Counter
+	errors         metric.Int64Counter
+	retries        metric.Int64Counter
+	tokenRefreshes metric.Int64Counter
+	duration       metric.Float64Histogram
+}
+
+// Instrument adds tracing and metrics to a. Spans are children of the span in the
+// context passed to the ...Context methods of a. Call it once before the first request.
+func Instrument(a *htbapi.API, opts ...Option) error {
+	c := config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		propagators:    otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	in := &instrumentation{
+		tracer:      c.tracerProvider.Tracer(ScopeName),
+		propagators: c.propagators,
+	}
+
+	meter := c.meterProvider.Meter(ScopeName)
+
+	var err error
+	if in.requests, err = meter.Int64Counter("htbapi.client.requests",
+		metric.WithDescription("Number of requests sent to the api including retries"),
+		metric.WithUnit("{request}")); err != nil {
+		return err
+	}
+	if in.errors, err = meter.Int64Counter("htbapi.client.errors",
+		metric.WithDescription("Number of failed api calls"),
+		metric.WithUnit("{error}")); err != nil {
+		return err
+	}
+	if in.retries, err = meter.Int64Counter("htbapi.client.retries",
+		metric.WithDescription("Number of retried requests"),
+		metric.WithUnit("{retry}")); err != nil {
+		return err
+	}
+	if in.tokenRefreshes, err = meter.Int64Counter("htbapi.client.token_refreshes",
+		metric.WithDescription("Number of token refreshes"),
+		metric.WithUnit("{refresh}")); err != nil {
+		return err
+	}
+	if in.duration, err = meter.Float64Histogram("htbapi.client.request.duration",
+		metric.WithDescription("Duration of requests sent to the api"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10)); err != nil {
+		return err
+	}
+
+	a.Use(in.middleware)
+	a.OnError(in.onError)
+	a.OnRetry(in.onRetry)
+	a.OnTokenRefresh(in.onTokenRefresh)
+
+	return nil
+}
+
+// middleware creates a client span for every request and records its duration
+func (in *instrumentation) middleware(next htbapi.Doer) htbapi.Doer {
+	return htbapi.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		tmpl := Template(htbapi.Endpoint(req))
+		attrs := []attribute.KeyValue{
+			MethodKey.String(req.Method),
+			TemplateKey.String(tmpl),
+		}
+
+		ctx, span := in.tracer.Start(req.Context(), req.Method+" "+tmpl,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+			trace.WithAttributes(ServerKey.String(req.URL.Hostname())),
+		)
+		defer span.End()
+
+		req = req.WithContext(ctx)
+		in.propagators.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		start := time.Now()
+		resp, err := next.Do(req)
+		elapsed := time.Since(start).Seconds()
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			attrs = append(attrs, ErrorTypeKey.String("transport"))
+		} else {
+			span.SetAttributes(StatusCodeKey.Int(resp.StatusCode))
+			if resp.StatusCode >= 400 {
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			}
+			attrs = append(attrs, StatusCodeKey.Int(resp.StatusCode))
+		}
+
+		set := metric.WithAttributes(attrs...)
+		in.requests.Add(ctx, 1, set)
+		in.duration.Record(ctx, elapsed, set)
+
+		return resp, err
+	})
+}
+
+// onError counts failed api calls
+func (in *instrumentation) onError(method, endpoint string, err error) {
+	errorType := "other"
+	var apiErr *htbapi.APIError
+	if errors.As(err, &apiErr) {
+		errorType = strconv.Itoa(apiErr.StatusCode)
+	}
+
+	in.errors.Add(context.Background(), 1, metric.WithAttributes(
+		MethodKey.String(method),
+		TemplateKey.String(Template(endpoint)),
+		ErrorTypeKey.String(errorType),
+	))
+}
+
+// onRetry counts retried requests
+func (in *instrumentation) onRetry(method, endpoint string, attempt int, wait time.Duration) {
+	in.retries.Add(context.Background(), 1, metric.WithAttributes(
+		MethodKey.String(method),
+		TemplateKey.String(Template(endpoint)),
+	))
+}
+
+// onTokenRefresh counts token refreshes
+func (in *instrumentation) onTokenRefresh(t *htbapi.Token) {
+	in.tokenRefreshes.Add(context.Background(), 1)
+}
+
+// Template returns endpoint without query and with all numeric path segments
+// replaced by {id}, e.g. "/machine/profile/{id}" for "/machine/profile/42".
+// It keeps the cardinality of span names and metric attributes low.
+func Template(endpoint string) string {
+	if i := strings.IndexByte(endpoint, '?'); i >= 0 {
+		endpoint = endpoint[:i]
+	}
+
+	segments := strings.Split(endpoint, "/")
+	for i, s := range segments {
+		if s == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
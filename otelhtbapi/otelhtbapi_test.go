@@ -0,0 +1,179 @@
+package otelhtbapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+	"github.com/patrickhener/go-htbapi/otelhtbapi"
+)
+
+// setup returns an instrumented API logged in to a fake api with machine 1
+func setup(t *testing.T) (*htbapi.API, *htbtest.Server, *tracetest.SpanRecorder, *sdktrace.TracerProvider, *sdkmetric.ManualReader) {
+	t.Helper()
+
+	s := htbtest.NewServer()
+	t.Cleanup(s.Close)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+
+	a, err := htbapi.New(
+		htbapi.WithBaseURL(s.BaseURL()),
+		htbapi.WithCredentials(htbtest.DefaultEmail, htbtest.DefaultPassword, false),
+		htbapi.WithRetryPolicy(htbapi.RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	err = otelhtbapi.Instrument(a,
+		otelhtbapi.WithTracerProvider(tp),
+		otelhtbapi.WithMeterProvider(mp),
+		otelhtbapi.WithPropagators(propagation.TraceContext{}),
+	)
+	if err != nil {
+		t.Fatalf("Instrument: %v", err)
+	}
+
+	return a, s, recorder, tp, reader
+}
+
+// counters collects the sums of all counters by name
+func counters(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					sums[m.Name] += dp.Value
+				}
+			}
+		}
+	}
+
+	return sums
+}
+
+func TestSpans(t *testing.T) {
+	a, _, recorder, tp, _ := setup(t)
+	if err := a.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	var traceparent string
+	a.OnRequest(func(req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+	})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := a.Machines.Get(ctx, 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	parent.End()
+
+	var span sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "GET /machine/profile/{id}" {
+			span = s
+		}
+	}
+	if span == nil {
+		t.Fatalf("no span for the profile request in %d spans", len(recorder.Ended()))
+	}
+
+	if span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span kind = %v, want client", span.SpanKind())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("span is no child of the span in the context")
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs[otelhtbapi.TemplateKey].AsString(); got != "/machine/profile/{id}" {
+		t.Errorf("url.template = %q", got)
+	}
+	if got := attrs[otelhtbapi.StatusCodeKey].AsInt64(); got != http.StatusOK {
+		t.Errorf("status code = %d", got)
+	}
+
+	sc := span.SpanContext()
+	want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	a, s, _, _, reader := setup(t)
+	ctx := context.Background()
+
+	// The token expires within the refresh skew, so the next request refreshes it
+	s.SetTokenTTL(30 * time.Second)
+	if err := a.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	s.SetTokenTTL(time.Hour)
+
+	s.InjectFault(htbtest.Fault{PathPrefix: "/machine/profile", Status: http.StatusBadGateway, Times: 1})
+	if _, err := a.Machines.Get(ctx, 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if _, err := a.Machines.Get(ctx, 2); !errors.Is(err, htbapi.ErrNotFound) {
+		t.Fatalf("Get of unknown machine: %v", err)
+	}
+
+	got := counters(t, reader)
+	want := map[string]int64{
+		// login, refresh, failed and retried profile and the unknown profile
+		"htbapi.client.requests":        5,
+		"htbapi.client.errors":          1,
+		"htbapi.client.retries":         1,
+		"htbapi.client.token_refreshes": 1,
+	}
+	for name, n := range want {
+		if got[name] != n {
+			t.Errorf("%s = %d, want %d", name, got[name], n)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := map[string]string{
+		"/machine/profile/42":        "/machine/profile/{id}",
+		"/machine/list":              "/machine/list",
+		"/user/profile/basic/7?x=1":  "/user/profile/basic/{id}",
+		"/challenge/download/3/file": "/challenge/download/{id}/file",
+	}
+	for endpoint, want := range tests {
+		if got := otelhtbapi.Template(endpoint); got != want {
+			t.Errorf("Template(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package htbapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prompter asks for the login details which are not set on the API
+type Prompter interface {
+	Email(ctx context.Context) (string, error)
+	Password(ctx context.Context) (string, error)
+	OTPProvider
+}
+
+// OTPProvider provides the one time password for the 2FA login
+type OTPProvider interface {
+	OTP(ctx context.Context) (string, error)
+}
+
+// WithPrompter sets the Prompter used by Login. It defaults to TerminalPrompter.
+// Passing nil disables prompting, so missing login details will cause an error.
+func WithPrompter(p Prompter) Option {
+	return func(a *API) error {
+		a.prompter = p
+		return nil
+	}
+}
+
+// WithOTPProvider sets where the one time password for the 2FA login comes from.
+// If it is not set the Prompter is asked.
+func WithOTPProvider(o OTPProvider) Option {
+	return func(a *API) error {
+		a.otpProvider = o
+		return nil
+	}
+}
+
+// WithTOTPSecret generates the one time passwords from the base32 2FA secret
+// of the account. This allows logging in unattended.
+func WithTOTPSecret(secret string) Option {
+	return func(a *API) error {
+		t, err := NewTOTP(secret)
+		if err != nil {
+			return err
+		}
+
+		a.otpProvider = t
+		return nil
+	}
+}
+
+// TerminalPrompter reads the login details from a terminal.
+// The zero value uses os.Stdin and os.Stdout. Password input is masked.
+type TerminalPrompter struct {
+	In  FdReader
+	Out io.Writer
+}
+
+// Email implements Prompter
+func (p *TerminalPrompter) Email(ctx context.Context) (string, error) {
+	return p.readLine("Enter email: ")
+}
+
+// Password implements Prompter
+func (p *TerminalPrompter) Password(ctx context.Context) (string, error) {
+	bytePassword, err := getPasswd("Enter Password: ", true, p.in(), p.out())
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytePassword), nil
+}
+
+// OTP implements OTPProvider
+func (p *TerminalPrompter) OTP(ctx context.Context) (string, error) {
+	otp, err := p.readLine("Enter OTP: ")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(p.out(), "")
+
+	return otp, nil
+}
+
+// readLine prints prompt and reads a single line. It reads byte by byte so no
+// input meant for the next prompt is consumed.
+func (p *TerminalPrompter) readLine(prompt string) (string, error) {
+	fmt.Fprint(p.out(), prompt)
+
+	var line []byte
+	for {
+		c, err := getch(p.in())
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if c == '\n' {
+			break
+		}
+
+		line = append(line, c)
+	}
+
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+func (p *TerminalPrompter) in() FdReader {
+	if p.In == nil {
+		return os.Stdin
+	}
+
+	return p.In
+}
+
+func (p *TerminalPrompter) out() io.Writer {
+	if p.Out == nil {
+		return os.Stdout
+	}
+
+	return p.Out
+}
@@ -0,0 +1,234 @@
+package htbapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiter which is applied to every request of an API.
+// It has a global limit and optional stricter limits for endpoint prefixes.
+// A request has to pass the global limit as well as the limit of the longest
+// matching prefix. It is safe for concurrent use and can be shared between APIs.
+type RateLimiter struct {
+	global *bucket
+
+	mu        sync.RWMutex
+	endpoints []*bucket
+}
+
+// LimitStats holds the wait time metrics of a single limit
+type LimitStats struct {
+	// Requests is the number of requests which passed the limit
+	Requests int64
+	// Throttled is the number of requests which had to wait
+	Throttled int64
+	// TotalWait is the summed up wait time of all requests
+	TotalWait time.Duration
+	// MaxWait is the longest time a single request had to wait
+	MaxWait time.Duration
+}
+
+// RateLimiterStats holds the metrics of the global limit and all endpoint limits
+type RateLimiterStats struct {
+	Global    LimitStats
+	Endpoints map[string]LimitStats
+}
+
+// NewRateLimiter returns a RateLimiter allowing rate requests per second with
+// bursts of up to burst requests. A rate of zero or less disables the global limit.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		global: newBucket("", rate, burst),
+	}
+}
+
+// WithRateLimiter will apply l to every request sent by the API
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(a *API) error {
+		a.rateLimiter = l
+		return nil
+	}
+}
+
+// SetEndpointLimit adds or replaces the limit of all endpoints starting with prefix,
+// e.g. "/machine/own" or "/vm/spawn". A rate of zero or less removes the limit.
+func (l *RateLimiter) SetEndpointLimit(prefix string, rate float64, burst int) error {
+	if !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("endpoint prefix has to start with /: %s", prefix)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	endpoints := l.endpoints[:0:0]
+	for _, b := range l.endpoints {
+		if b.prefix != prefix {
+			endpoints = append(endpoints, b)
+		}
+	}
+
+	if rate > 0 {
+		endpoints = append(endpoints, newBucket(prefix, rate, burst))
+	}
+
+	// Longest prefix first so the most specific limit is matched
+	sort.Slice(endpoints, func(i, j int) bool {
+		return len(endpoints[i].prefix) > len(endpoints[j].prefix)
+	})
+	l.endpoints = endpoints
+
+	return nil
+}
+
+// Wait blocks until a request to endpoint is allowed or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context, endpoint string) error {
+	now := time.Now()
+
+	buckets := []*bucket{l.global}
+	if b := l.match(endpoint); b != nil {
+		buckets = append(buckets, b)
+	}
+
+	var wait time.Duration
+	waits := make([]time.Duration, len(buckets))
+	for i, b := range buckets {
+		waits[i] = b.reserve(now)
+		if waits[i] > wait {
+			wait = waits[i]
+		}
+	}
+
+	if err := sleep(ctx, wait); err != nil {
+		for _, b := range buckets {
+			b.cancel()
+		}
+		return err
+	}
+
+	for i, b := range buckets {
+		b.record(waits[i])
+	}
+
+	return nil
+}
+
+// Stats returns the current wait time metrics
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	stats := RateLimiterStats{
+		Global:    l.global.snapshot(),
+		Endpoints: make(map[string]LimitStats, len(l.endpoints)),
+	}
+	for _, b := range l.endpoints {
+		stats.Endpoints[b.prefix] = b.snapshot()
+	}
+
+	return stats
+}
+
+// match returns the bucket with the longest prefix matching endpoint
+func (l *RateLimiter) match(endpoint string) *bucket {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, b := range l.endpoints {
+		if strings.HasPrefix(endpoint, b.prefix) {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// bucket is a single token bucket
+type bucket struct {
+	prefix string
+	rate   float64
+	burst  float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	stats  LimitStats
+}
+
+// newBucket returns a full bucket. Burst will be at least 1.
+func newBucket(prefix string, rate float64, burst int) *bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &bucket{
+		prefix: prefix,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait until it is valid
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// record adds a request which passed the bucket after waiting for wait to the stats
+func (b *bucket) record(wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Requests++
+	if wait <= 0 {
+		return
+	}
+
+	b.stats.Throttled++
+	b.stats.TotalWait += wait
+	if wait > b.stats.MaxWait {
+		b.stats.MaxWait = wait
+	}
+}
+
+// cancel returns a reserved token to the bucket
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate > 0 {
+		b.tokens++
+	}
+}
+
+// snapshot returns a copy of the current stats
+func (b *bucket) snapshot() LimitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stats
+}
@@ -0,0 +1,136 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+func TestRateLimiterLongestPrefix(t *testing.T) {
+	l := htbapi.NewRateLimiter(1000, 100)
+	if err := l.SetEndpointLimit("/machine", 1000, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetEndpointLimit("/machine/own", 0.001, 1); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, endpoint := range []string{"/machine/own", "/machine/profile/1", "/machine/list", "/connections"} {
+		if err := l.Wait(ctx, endpoint); err != nil {
+			t.Fatalf("Wait(%s): %v", endpoint, err)
+		}
+	}
+
+	// The burst of /machine/own is used up although /machine and the global limit allow more
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "/machine/own"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait(/machine/own) error = %v, want DeadlineExceeded", err)
+	}
+
+	stats := l.Stats()
+	if stats.Global.Requests != 4 {
+		t.Errorf("global requests = %d, want 4", stats.Global.Requests)
+	}
+	if n := stats.Endpoints["/machine/own"].Requests; n != 1 {
+		t.Errorf("/machine/own requests = %d, want 1", n)
+	}
+	if n := stats.Endpoints["/machine"].Requests; n != 2 {
+		t.Errorf("/machine requests = %d, want 2", n)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := htbapi.NewRateLimiter(0.001, 1)
+
+	if err := l.Wait(context.Background(), "/machine/own"); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	if err := l.Wait(ctx, "/machine/own"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait error = %v, want Canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Wait returned after %v, want right after cancellation", d)
+	}
+
+	// The canceled request neither passed nor was throttled
+	if stats := l.Stats().Global; stats.Requests != 1 || stats.Throttled != 0 {
+		t.Errorf("stats = %+v, want 1 request and none throttled", stats)
+	}
+}
+
+func TestRateLimiterStats(t *testing.T) {
+	l := htbapi.NewRateLimiter(20, 2)
+	ctx := context.Background()
+
+	// The burst passes right away, the third request waits about 50ms
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, "/machine/list"); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+
+	stats := l.Stats().Global
+	if stats.Requests != 3 || stats.Throttled != 1 {
+		t.Errorf("stats = %+v, want 3 requests of which 1 throttled", stats)
+	}
+	if stats.MaxWait <= 0 || stats.MaxWait > 50*time.Millisecond {
+		t.Errorf("max wait = %v, want up to 50ms", stats.MaxWait)
+	}
+	if stats.TotalWait != stats.MaxWait {
+		t.Errorf("total wait = %v, want the single wait %v", stats.TotalWait, stats.MaxWait)
+	}
+	if len(l.Stats().Endpoints) != 0 {
+		t.Errorf("endpoint stats = %v, want none", l.Stats().Endpoints)
+	}
+}
+
+func TestRateLimiterSetEndpointLimit(t *testing.T) {
+	l := htbapi.NewRateLimiter(0, 0)
+
+	if err := l.SetEndpointLimit("machine/own", 1, 1); err == nil {
+		t.Error("SetEndpointLimit without leading /: want an error")
+	}
+
+	if err := l.SetEndpointLimit("/machine/own", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetEndpointLimit("/machine/own", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints := l.Stats().Endpoints; len(endpoints) != 0 {
+		t.Errorf("endpoint stats = %v, want the limit removed", endpoints)
+	}
+}
+
+func TestRateLimiterAPI(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	l := htbapi.NewRateLimiter(1000, 10)
+	if err := l.SetEndpointLimit("/machine/profile", 1000, 10); err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAPI(t, s, htbapi.WithRateLimiter(l))
+
+	if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	stats := l.Stats()
+	// The login and the profile pass the global limit
+	if stats.Global.Requests != 2 {
+		t.Errorf("global requests = %d, want 2", stats.Global.Requests)
+	}
+	if n := stats.Endpoints["/machine/profile"].Requests; n != 1 {
+		t.Errorf("/machine/profile requests = %d, want 1", n)
+	}
+}
@@ -0,0 +1,147 @@
+package htbapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultRefreshSkew is the time before expiry at which the access_token gets refreshed
+const DefaultRefreshSkew = time.Minute
+
+// refreshCall is a login or token refresh in progress other goroutines can wait for
+type refreshCall struct {
+	done chan struct{}
+	err  error
+	// abandoned is set if the call failed because the context of its caller ended
+	abandoned bool
+}
+
+// WithRefreshSkew sets how long before its expiry the access_token will be refreshed.
+// It defaults to DefaultRefreshSkew.
+func WithRefreshSkew(d time.Duration) Option {
+	return func(a *API) error {
+		if d < 0 {
+			return fmt.Errorf("invalid refresh skew: %s", d)
+		}
+
+		a.refreshSkew = d
+		return nil
+	}
+}
+
+// credentials returns the current access_token and refresh_token
+func (a *API) credentials() (string, string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.Token, a.RefreshToken
+}
+
+// setCredentials stores the session details of a login or refresh response
+func (a *API) setCredentials(m LoginResponseMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.Token = m.AccessToken
+	a.RefreshToken = m.RefreshToken
+	a.Is2FAEnabled = m.Is2FAEnabled
+	a.TokenHas2FA = m.TokenHas2FA
+}
+
+// sessionDetails returns the current session details
+func (a *API) sessionDetails() LoginResponseMessage {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return LoginResponseMessage{
+		AccessToken:  a.Token,
+		Is2FAEnabled: a.Is2FAEnabled,
+		RefreshToken: a.RefreshToken,
+		TokenHas2FA:  a.TokenHas2FA,
+	}
+}
+
+// validToken returns an access_token which is valid for at least the refresh skew.
+// If the current one expires earlier it will be refreshed first.
+func (a *API) validToken(ctx context.Context) (string, error) {
+	token, _ := a.credentials()
+
+	claims, err := ParseToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	if (&Token{AccessToken: token, Expiry: claims.ExpiresAt}).validFor(a.refreshSkew) {
+		return token, nil
+	}
+
+	if err := a.refresh(ctx, token); err != nil {
+		return "", err
+	}
+
+	token, _ = a.credentials()
+	return token, nil
+}
+
+// refresh will refresh the session unless stale was replaced in the meantime.
+// Concurrent calls are collapsed into a single refresh request and all callers
+// get its result.
+func (a *API) refresh(ctx context.Context, stale string) error {
+	return a.singleFlight(ctx, stale, func(ctx context.Context) error {
+		err := a.doRefreshToken(ctx)
+		a.logRefresh(ctx, err)
+		return err
+	})
+}
+
+// login logs in unless there is a session already. Concurrent calls share one
+// login, so the prompter is asked only once.
+func (a *API) login(ctx context.Context) error {
+	return a.singleFlight(ctx, "", a.LoginContext)
+}
+
+// singleFlight runs fn to replace the access_token unless stale was replaced in the
+// meantime. While fn runs other calls wait for its result. If the caller running fn
+// gives up because its context ended, a waiter whose context is alive takes over.
+func (a *API) singleFlight(ctx context.Context, stale string, fn func(ctx context.Context) error) error {
+	for {
+		a.refreshMu.Lock()
+
+		// A login sets the token before the 2FA step, so a call in flight is waited for first
+		if c := a.refreshing; c != nil {
+			a.refreshMu.Unlock()
+
+			select {
+			case <-c.done:
+				if !c.abandoned {
+					return c.err
+				}
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if token, _ := a.credentials(); token != stale {
+			a.refreshMu.Unlock()
+			return nil
+		}
+
+		break
+	}
+
+	c := &refreshCall{done: make(chan struct{})}
+	a.refreshing = c
+	a.refreshMu.Unlock()
+
+	c.err = fn(ctx)
+	c.abandoned = c.err != nil && ctx.Err() != nil
+
+	a.refreshMu.Lock()
+	a.refreshing = nil
+	a.refreshMu.Unlock()
+	close(c.done)
+
+	return c.err
+}
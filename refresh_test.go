@@ -0,0 +1,107 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// newExpiringAPI returns an API whose access_token expires within the refresh skew,
+// so the next request refreshes it. Refreshed tokens are valid for an hour.
+func newExpiringAPI(t *testing.T, s *htbtest.Server) *htbapi.API {
+	t.Helper()
+
+	s.SetTokenTTL(30 * time.Second)
+	a := newTestAPI(t, s)
+	login(t, a)
+	s.SetTokenTTL(time.Hour)
+
+	return a
+}
+
+func TestRefreshSingleFlight(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	a := newExpiringAPI(t, s)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.Machines.Get(context.Background(), 1)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Get: %v", err)
+		}
+	}
+	if n := s.RequestCount(http.MethodPost, "/login/refresh"); n != 1 {
+		t.Errorf("%d refresh requests, want 1", n)
+	}
+}
+
+func TestRefreshLeaderCanceled(t *testing.T) {
+	s := newTestServer(t)
+	a := newExpiringAPI(t, s)
+
+	// Holds the first refresh until the context of the leader ends
+	s.InjectFault(htbtest.Fault{PathPrefix: "/login/refresh", Delay: time.Second, Times: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	leader := make(chan error, 1)
+	go func() {
+		leader <- a.DoRefreshTokenContext(ctx)
+	}()
+
+	// Wait until the leader's request is in flight before the others join
+	for s.RequestCount(http.MethodPost, "/login/refresh") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- a.DoRefreshTokenContext(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-leader; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("leader err = %v, want deadline exceeded", err)
+	}
+	for err := range errs {
+		if err != nil {
+			t.Errorf("waiter err = %v", err)
+		}
+	}
+	if n := s.RequestCount(http.MethodPost, "/login/refresh"); n != 2 {
+		t.Errorf("%d refresh requests, want 2", n)
+	}
+
+	claims, err := a.TokenInfo()
+	if err != nil {
+		t.Fatalf("TokenInfo: %v", err)
+	}
+	if claims.ExpiresIn() < 30*time.Minute {
+		t.Errorf("token expires in %s, want a refreshed one", claims.ExpiresIn())
+	}
+}
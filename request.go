@@ -0,0 +1,231 @@
+package htbapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request is a request to the api built with NewRequest. Its body is kept in
+// memory so it can be sent again when retried.
+type Request struct {
+	a           *API
+	method      string
+	endpoint    string
+	query       url.Values
+	header      http.Header
+	body        []byte
+	contentType string
+	authorized  bool
+	noCache     bool
+	err         error
+}
+
+// MultipartFile is a file sent within a multipart body
+type MultipartFile struct {
+	Field    string
+	FileName string
+	Content  io.Reader
+}
+
+// NewRequest starts building a request with any http method to endpoint,
+// e.g. a.NewRequest(http.MethodDelete, "/machine/todo/update/1").
+// The request is authorized with the Bearer Token unless Unauthorized is called.
+func (a *API) NewRequest(method, endpoint string) *Request {
+	return &Request{
+		a:          a,
+		method:     strings.ToUpper(method),
+		endpoint:   endpoint,
+		query:      url.Values{},
+		header:     http.Header{},
+		authorized: true,
+	}
+}
+
+// Query adds a query parameter
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Header sets a header. It overrides the default headers of the api.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Unauthorized sends the request without Bearer Token
+func (r *Request) Unauthorized() *Request {
+	r.authorized = false
+	return r
+}
+
+// NoCache makes the request skip cached responses, see WithCache.
+// A successful response still replaces the cached one.
+func (r *Request) NoCache() *Request {
+	r.noCache = true
+	return r
+}
+
+// JSON sets v marshaled to json as body. []byte and json.RawMessage are sent as they are.
+func (r *Request) JSON(v interface{}) *Request {
+	data, err := marshalBody(v)
+	if err != nil {
+		r.err = err
+		return r
+	}
+
+	if data == nil {
+		r.body, r.contentType = nil, ""
+		return r
+	}
+
+	return r.RawBody(data, "application/json")
+}
+
+// Form sets values as url encoded form body
+func (r *Request) Form(values url.Values) *Request {
+	return r.RawBody([]byte(values.Encode()), "application/x-www-form-urlencoded")
+}
+
+// Multipart sets a multipart/form-data body with fields and files
+func (r *Request) Multipart(fields map[string]string, files ...MultipartFile) *Request {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			r.err = err
+			return r
+		}
+	}
+
+	for _, f := range files {
+		part, err := w.CreateFormFile(f.Field, f.FileName)
+		if err != nil {
+			r.err = err
+			return r
+		}
+		if _, err := io.Copy(part, f.Content); err != nil {
+			r.err = err
+			return r
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		r.err = err
+		return r
+	}
+
+	return r.RawBody(buf.Bytes(), w.FormDataContentType())
+}
+
+// RawBody sets data as body with contentType
+func (r *Request) RawBody(data []byte, contentType string) *Request {
+	r.body = data
+	r.contentType = contentType
+	return r
+}
+
+// Do sends the request and returns the response. Retries and rate limits of the API
+// apply. The status is not checked, so the caller has to close the body.
+func (r *Request) Do(ctx context.Context) (*http.Response, error) {
+	resp, err := r.do(ctx)
+	if err != nil {
+		r.a.fireError(r.method, r.endpoint, err)
+	}
+
+	return resp, err
+}
+
+// do gets the token if needed and sends the request
+func (r *Request) do(ctx context.Context) (*http.Response, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var token string
+	if r.authorized {
+		t, err := r.a.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		token = t.AccessToken
+	}
+
+	if r.a.cache != nil {
+		return r.a.sendCached(ctx, r, token)
+	}
+
+	return r.a.send(ctx, r, token)
+}
+
+// Fetch sends the request and decodes the json response into T.
+// Error responses are returned as *APIError.
+func Fetch[T any](ctx context.Context, r *Request) (T, error) {
+	resp, err := r.Do(ctx)
+	if err != nil {
+		var out T
+		return out, err
+	}
+
+	out, err := decodeResponse[T](resp, r.method, r.endpoint)
+	if err != nil {
+		r.a.fireError(r.method, r.endpoint, err)
+	}
+
+	return out, err
+}
+
+// url returns the full url of the request including the query
+func (r *Request) url() string {
+	u := fmt.Sprintf("%s%s", r.a.BaseURL, r.endpoint)
+	if len(r.query) == 0 {
+		return u
+	}
+
+	sep := "?"
+	if strings.Contains(r.endpoint, "?") {
+		sep = "&"
+	}
+
+	return u + sep + r.query.Encode()
+}
+
+// httpRequest will construct the http request with all headers the api expects
+func (r *Request) httpRequest(ctx context.Context, token string) (*http.Request, error) {
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req, err := http.NewRequestWithContext(withEndpoint(ctx, r.endpoint), r.method, r.url(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json, text/plain, */*")
+	req.Header.Add("Origin", "https://app.hackthebox.com")
+	req.Header.Add("Referer", "https://app.hackthebox.com/")
+	if r.a.userAgent != "" {
+		req.Header.Set("User-Agent", r.a.userAgent)
+	}
+
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	return req, nil
+}
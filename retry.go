@@ -0,0 +1,186 @@
+package htbapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy describes if and how often a failed request will be sent again
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+	// MinBackoff is the wait time before the first retry. It doubles with every attempt.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait time between two attempts
+	MaxBackoff time.Duration
+	// Jitter is the fraction (0 to 1) by which the backoff is randomly reduced
+	Jitter float64
+	// MaxRetryAfter is the longest Retry-After the client is willing to wait.
+	// If the server asks for more the response is returned as it is. Zero means no limit.
+	MaxRetryAfter time.Duration
+	// Retryable decides if a request is retried. resp is nil if err is set.
+	// If it is nil DefaultRetryable is used.
+	Retryable func(method, endpoint string, resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy returns the policy every API uses unless WithRetryPolicy is given
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   4,
+		MinBackoff:    500 * time.Millisecond,
+		MaxBackoff:    30 * time.Second,
+		Jitter:        0.2,
+		MaxRetryAfter: 2 * time.Minute,
+		Retryable:     DefaultRetryable,
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests.
+// Use RetryPolicy{MaxAttempts: 1} to disable retries.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(a *API) error {
+		if p.MinBackoff < 0 || p.MaxBackoff < 0 || p.MaxRetryAfter < 0 {
+			return fmt.Errorf("%s", "retry backoff must not be negative")
+		}
+		if p.Jitter < 0 || p.Jitter > 1 {
+			return fmt.Errorf("retry jitter has to be between 0 and 1, got %v", p.Jitter)
+		}
+
+		a.retryPolicy = p
+		return nil
+	}
+}
+
+// DefaultRetryable is the retry decision used by DefaultRetryPolicy.
+// Idempotent requests are retried on connection errors, 429 and 5xx responses.
+// Flag submissions (endpoints ending in /own) are only retried on connection errors.
+// All other requests are only retried on 429 as the server did not process them.
+func DefaultRetryable(method, endpoint string, resp *http.Response, err error) bool {
+	if isFlagSubmission(endpoint) {
+		return err != nil
+	}
+
+	if err != nil {
+		return isIdempotent(method)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isIdempotent(method)
+	}
+
+	return false
+}
+
+// isIdempotent reports if sending a request with method twice is safe
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// isFlagSubmission reports if the endpoint is used to submit a flag
+func isFlagSubmission(endpoint string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(endpoint, "/"), "/own")
+}
+
+// shouldRetry decides if another attempt will be made and how long to wait before.
+// attempt is the number of the attempt which just failed starting at 1.
+func (p RetryPolicy) shouldRetry(ctx context.Context, attempt int, method, endpoint string, resp *http.Response, err error) (bool, time.Duration) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return false, 0
+	}
+
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+	if !retryable(method, endpoint, resp, err) {
+		return false, 0
+	}
+
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if p.MaxRetryAfter > 0 && wait > p.MaxRetryAfter {
+				return false, 0
+			}
+			return true, wait
+		}
+	}
+
+	return true, p.backoff(attempt)
+}
+
+// backoff returns the exponential backoff with jitter for the given attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.MinBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+
+	return time.Duration(d)
+}
+
+// parseRetryAfter parses the Retry-After header which is either seconds or a http date
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	wait := t.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, true
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// drainBody reads a bit of the body and closes it so the connection can be reused
+func drainBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, 4<<10))
+	body.Close()
+}
@@ -0,0 +1,177 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// retryRecorder records the waits of all retries
+type retryRecorder struct {
+	mu    sync.Mutex
+	waits []time.Duration
+}
+
+func (r *retryRecorder) onRetry(method, endpoint string, attempt int, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.waits = append(r.waits, wait)
+}
+
+func (r *retryRecorder) retries() []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]time.Duration(nil), r.waits...)
+}
+
+// newRetryAPI returns a logged in API retrying with a short backoff and machine 1 spawned
+func newRetryAPI(t *testing.T, s *htbtest.Server, p htbapi.RetryPolicy) (*htbapi.API, *retryRecorder) {
+	t.Helper()
+
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+
+	a := newTestAPI(t, s, htbapi.WithRetryPolicy(p))
+	login(t, a)
+	if _, err := a.Machines.Spawn(context.Background(), 1, htbapi.Lab); err != nil {
+		t.Fatalf("Spawn: %v", err)
+	}
+
+	r := &retryRecorder{}
+	a.OnRetry(r.onRetry)
+
+	return a, r
+}
+
+// fastRetries retries up to three times with a millisecond backoff
+var fastRetries = htbapi.RetryPolicy{
+	MaxAttempts:   4,
+	MinBackoff:    time.Millisecond,
+	MaxBackoff:    10 * time.Millisecond,
+	MaxRetryAfter: time.Minute,
+}
+
+func TestRetryTooManyRequests(t *testing.T) {
+	s := newTestServer(t)
+	a, r := newRetryAPI(t, s, fastRetries)
+
+	s.InjectFault(htbtest.Fault{
+		PathPrefix: "/machine/profile",
+		Status:     http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"1"}},
+		Times:      1,
+	})
+
+	before := s.RequestCount(http.MethodGet, "/machine/profile/1")
+	if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if waits := r.retries(); len(waits) != 1 || waits[0] != time.Second {
+		t.Errorf("retries waited %v, want [1s] from Retry-After", waits)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1") - before; n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestRetryServerErrorOnGet(t *testing.T) {
+	s := newTestServer(t)
+	a, r := newRetryAPI(t, s, fastRetries)
+
+	s.InjectFault(htbtest.Fault{PathPrefix: "/machine/profile", Status: http.StatusServiceUnavailable, Times: 2})
+
+	before := s.RequestCount(http.MethodGet, "/machine/profile/1")
+	if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if n := len(r.retries()); n != 2 {
+		t.Errorf("%d retries, want 2", n)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1") - before; n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestRetryServerErrorOnOwn(t *testing.T) {
+	s := newTestServer(t)
+	a, r := newRetryAPI(t, s, fastRetries)
+
+	s.InjectFault(htbtest.Fault{PathPrefix: "/machine/own", Status: http.StatusInternalServerError, Times: 1})
+
+	_, err := a.Machines.Submit(context.Background(), 1, "user", 5, htbapi.Lab)
+	var apiErr *htbapi.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("err = %v, want the 500 of the flag submission", err)
+	}
+
+	if n := len(r.retries()); n != 0 {
+		t.Errorf("%d retries of a flag submission, want 0", n)
+	}
+	if n := s.RequestCount(http.MethodPost, "/machine/own"); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+	if user, _ := s.Owns(1); user {
+		t.Error("flag was submitted although the request failed")
+	}
+}
+
+func TestRetryDroppedConnectionOnOwn(t *testing.T) {
+	s := newTestServer(t)
+	a, r := newRetryAPI(t, s, fastRetries)
+
+	s.InjectFault(htbtest.Fault{PathPrefix: "/machine/own", CloseConnection: true, Times: 1})
+
+	if _, err := a.Machines.Submit(context.Background(), 1, "user", 5, htbapi.Lab); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	if n := len(r.retries()); n != 1 {
+		t.Errorf("%d retries, want 1", n)
+	}
+	if n := s.RequestCount(http.MethodPost, "/machine/own"); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+	if user, _ := s.Owns(1); !user {
+		t.Error("user flag not owned")
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	s := newTestServer(t)
+	p := fastRetries
+	p.MaxRetryAfter = time.Second
+	a, r := newRetryAPI(t, s, p)
+
+	s.InjectFault(htbtest.Fault{
+		PathPrefix: "/machine/profile",
+		Status:     http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"120"}},
+		Times:      1,
+	})
+
+	before := s.RequestCount(http.MethodGet, "/machine/profile/1")
+	start := time.Now()
+	_, err := a.Machines.Get(context.Background(), 1)
+	if !errors.Is(err, htbapi.ErrRateLimited) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Get took %s, want it to give up at once", d)
+	}
+
+	if n := len(r.retries()); n != 0 {
+		t.Errorf("%d retries, want 0", n)
+	}
+	if n := s.RequestCount(http.MethodGet, "/machine/profile/1") - before; n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
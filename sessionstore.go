@@ -0,0 +1,348 @@
+package htbapi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrProfileNotFound is returned by a SessionStore if there is no session for a profile
+var ErrProfileNotFound = errors.New("profile not found")
+
+// sessionFileVersion is the format version written by FileSessionStore
+const sessionFileVersion = 1
+
+// scrypt parameters as recommended for interactive logins. Files asking for more
+// are rejected, so a tampered file cannot make read allocate huge amounts of memory.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// Session holds everything needed to restore a logged in API
+type Session struct {
+	AccessToken string `json:"access_token"`
+	// Cookies only hold name and value, as a cookie jar does not return domain,
+	// path and expiry. They are restored as session cookies of the base url.
+	Cookies      []*http.Cookie `json:"cookies"`
+	Is2FAEnabled bool           `json:"is2FAEnabled"`
+	RefreshToken string         `json:"refresh_token"`
+	TokenHas2FA  bool           `json:"tokenHas2FA"`
+}
+
+// SessionStore persists sessions under a profile name, e.g. one for a personal and
+// one for a team account. Implementations have to be safe for concurrent use.
+type SessionStore interface {
+	// Load returns the session of profile or ErrProfileNotFound
+	Load(profile string) (*Session, error)
+	// Save adds or replaces the session of profile
+	Save(profile string, s *Session) error
+	// Delete removes the session of profile
+	Delete(profile string) error
+	// Profiles returns the names of all stored profiles
+	Profiles() ([]string, error)
+}
+
+// FileSessionStore keeps all profiles in a single file encrypted with a passphrase.
+// The key is derived with scrypt and the data is sealed with AES-GCM. The file is
+// replaced atomically on every write.
+type FileSessionStore struct {
+	path       string
+	passphrase []byte
+
+	mu sync.Mutex
+}
+
+// sessionFile is the on disk format of FileSessionStore
+type sessionFile struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// NewFileSessionStore returns a FileSessionStore writing to path. The file will
+// be created on the first Save.
+func NewFileSessionStore(path, passphrase string) (*FileSessionStore, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%s", "passphrase must not be empty")
+	}
+
+	return &FileSessionStore{
+		path:       path,
+		passphrase: []byte(passphrase),
+	}, nil
+}
+
+// Load implements SessionStore
+func (s *FileSessionStore) Load(profile string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	session, ok := profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, profile)
+	}
+
+	return session, nil
+}
+
+// Save implements SessionStore
+func (s *FileSessionStore) Save(profile string, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	profiles[profile] = session
+
+	return s.write(profiles)
+}
+
+// Delete implements SessionStore
+func (s *FileSessionStore) Delete(profile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := profiles[profile]; !ok {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, profile)
+	}
+	delete(profiles, profile)
+
+	return s.write(profiles)
+}
+
+// Profiles implements SessionStore
+func (s *FileSessionStore) Profiles() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// read decrypts all profiles. A missing file yields no profiles.
+func (s *FileSessionStore) read() (map[string]*Session, error) {
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]*Session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file sessionFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("error reading the session file: %+v", err)
+	}
+	if file.Version != sessionFileVersion {
+		return nil, fmt.Errorf("unsupported session file version %d", file.Version)
+	}
+	if file.N < 2 || file.N > scryptN || file.R < 1 || file.R > scryptR || file.P < 1 || file.P > scryptP {
+		return nil, fmt.Errorf("invalid scrypt parameters in session file: N=%d r=%d p=%d", file.N, file.R, file.P)
+	}
+
+	key, err := scrypt.Key(s.passphrase, file.Salt, file.N, file.R, file.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%s", "invalid nonce in session file")
+	}
+
+	data, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s", "cannot decrypt session file, wrong passphrase?")
+	}
+
+	profiles := map[string]*Session{}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// write encrypts all profiles with a fresh salt and nonce and replaces the file
+func (s *FileSessionStore) write(profiles map[string]*Session) error {
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		return err
+	}
+
+	file := sessionFile{
+		Version: sessionFileVersion,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLen),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+
+	key, err := scrypt.Key(s.passphrase, file.Salt, file.N, file.R, file.P, scryptKeyLen)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, data, nil)
+
+	raw, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, raw, 0600)
+}
+
+// newGCM returns an AES-GCM cipher for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it afterwards,
+// so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// SaveSession stores the current session including the cookies under profile.
+// Only name and value of the cookies are kept, see Session.Cookies.
+func (a *API) SaveSession(store SessionStore, profile string) error {
+	details := a.sessionDetails()
+	if details.AccessToken == "" {
+		return fmt.Errorf("%s", "there is no valid session yet")
+	}
+
+	session := &Session{
+		AccessToken:  details.AccessToken,
+		Is2FAEnabled: details.Is2FAEnabled,
+		RefreshToken: details.RefreshToken,
+		TokenHas2FA:  details.TokenHas2FA,
+	}
+
+	if a.Session.Jar != nil {
+		u, err := url.Parse(a.BaseURL)
+		if err != nil {
+			return err
+		}
+		session.Cookies = a.Session.Jar.Cookies(u)
+	}
+
+	return store.Save(profile, session)
+}
+
+// LoadSession restores the session stored under profile. An expired access_token
+// will be refreshed with the next request as long as the refresh_token is valid.
+func (a *API) LoadSession(store SessionStore, profile string) error {
+	session, err := store.Load(profile)
+	if err != nil {
+		return err
+	}
+
+	a.setCredentials(LoginResponseMessage{
+		AccessToken:  session.AccessToken,
+		Is2FAEnabled: session.Is2FAEnabled,
+		RefreshToken: session.RefreshToken,
+		TokenHas2FA:  session.TokenHas2FA,
+	})
+
+	if a.Session.Jar != nil && len(session.Cookies) > 0 {
+		u, err := url.Parse(a.BaseURL)
+		if err != nil {
+			return err
+		}
+		a.Session.Jar.SetCookies(u, session.Cookies)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package htbapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/patrickhener/go-htbapi"
+)
+
+// newSessionStore returns a FileSessionStore in a temp dir
+func newSessionStore(t *testing.T, passphrase string) (*htbapi.FileSessionStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := htbapi.NewFileSessionStore(path, passphrase)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore: %v", err)
+	}
+
+	return store, path
+}
+
+// editSessionFile applies edit to the raw json of the session file at path
+func editSessionFile(t *testing.T, path string, edit func(file map[string]interface{})) {
+	t.Helper()
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file map[string]interface{}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		t.Fatal(err)
+	}
+
+	edit(file)
+
+	if raw, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	store, path := newSessionStore(t, "passphrase")
+
+	if _, err := store.Load("personal"); !errors.Is(err, htbapi.ErrProfileNotFound) {
+		t.Errorf("Load before Save error = %v, want ErrProfileNotFound", err)
+	}
+
+	personal := &htbapi.Session{AccessToken: "access", RefreshToken: "refresh", Is2FAEnabled: true, TokenHas2FA: true}
+	team := &htbapi.Session{AccessToken: "team-access", RefreshToken: "team-refresh"}
+	if err := store.Save("personal", personal); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Save("team", team); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// A second store reads what the first one wrote
+	store, err := htbapi.NewFileSessionStore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load("personal")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(got, personal) {
+		t.Errorf("Load = %+v, want %+v", got, personal)
+	}
+
+	profiles, err := store.Profiles()
+	if err != nil {
+		t.Fatalf("Profiles: %v", err)
+	}
+	if want := []string{"personal", "team"}; !reflect.DeepEqual(profiles, want) {
+		t.Errorf("Profiles = %v, want %v", profiles, want)
+	}
+
+	if err := store.Delete("team"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Load("team"); !errors.Is(err, htbapi.ErrProfileNotFound) {
+		t.Errorf("Load after Delete error = %v, want ErrProfileNotFound", err)
+	}
+	if err := store.Delete("team"); !errors.Is(err, htbapi.ErrProfileNotFound) {
+		t.Errorf("Delete twice error = %v, want ErrProfileNotFound", err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "team-access") || strings.Contains(string(raw), "team-refresh") {
+		t.Errorf("session file is not encrypted:\n%s", raw)
+	}
+}
+
+func TestFileSessionStoreEmptyPassphrase(t *testing.T) {
+	if _, err := htbapi.NewFileSessionStore(filepath.Join(t.TempDir(), "sessions.json"), ""); err == nil {
+		t.Error("NewFileSessionStore with empty passphrase: want an error")
+	}
+}
+
+func TestFileSessionStoreWrongPassphrase(t *testing.T) {
+	store, path := newSessionStore(t, "passphrase")
+	if err := store.Save("personal", &htbapi.Session{AccessToken: "access"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	wrong, err := htbapi.NewFileSessionStore(path, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Load("personal"); err == nil {
+		t.Error("Load with wrong passphrase: want an error")
+	}
+	// Saving must not overwrite a file which cannot be decrypted
+	if err := wrong.Save("other", &htbapi.Session{}); err == nil {
+		t.Error("Save with wrong passphrase: want an error")
+	}
+	if _, err := store.Load("personal"); err != nil {
+		t.Errorf("Load after failed Save: %v", err)
+	}
+}
+
+func TestFileSessionStoreTampered(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(file map[string]interface{})
+	}{
+		{"ciphertext", func(file map[string]interface{}) {
+			data := []byte(file["data"].(string))
+			// Flip a base64 character, the data stays decodable
+			if data[0] == 'A' {
+				data[0] = 'B'
+			} else {
+				data[0] = 'A'
+			}
+			file["data"] = string(data)
+		}},
+		{"nonce", func(file map[string]interface{}) { file["nonce"] = "AAAA" }},
+		{"version", func(file map[string]interface{}) { file["version"] = 2 }},
+		{"N too large", func(file map[string]interface{}) { file["n"] = 1 << 20 }},
+		{"N too small", func(file map[string]interface{}) { file["n"] = 1 }},
+		{"r too large", func(file map[string]interface{}) { file["r"] = 64 }},
+		{"r zero", func(file map[string]interface{}) { file["r"] = 0 }},
+		{"p too large", func(file map[string]interface{}) { file["p"] = 16 }},
+		{"p zero", func(file map[string]interface{}) { file["p"] = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, path := newSessionStore(t, "passphrase")
+			if err := store.Save("personal", &htbapi.Session{AccessToken: "access"}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			editSessionFile(t, path, tt.edit)
+
+			if _, err := store.Load("personal"); err == nil {
+				t.Error("Load of tampered file: want an error")
+			}
+		})
+	}
+}
+
+func TestSaveLoadSession(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	store, _ := newSessionStore(t, "passphrase")
+
+	a := newTestAPI(t, s)
+	if err := a.SaveSession(store, "personal"); err == nil {
+		t.Error("SaveSession without a session: want an error")
+	}
+
+	login(t, a)
+	u, err := url.Parse(a.BaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Session.Jar.SetCookies(u, []*http.Cookie{{Name: "htb_session", Value: "cookie"}})
+
+	if err := a.SaveSession(store, "personal"); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+
+	// b never logs in and uses the restored session only
+	b := newTestAPI(t, s, htbapi.WithCredentials("", "", false))
+	if err := b.LoadSession(store, "personal"); err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	if b.Token != a.Token {
+		t.Errorf("restored token = %q, want %q", b.Token, a.Token)
+	}
+
+	cookies := b.Session.Jar.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "htb_session" || cookies[0].Value != "cookie" {
+		t.Errorf("restored cookies = %v, want htb_session=cookie", cookies)
+	}
+
+	logins := s.RequestCount(http.MethodPost, "/login")
+	if _, err := b.Machines.Get(context.Background(), 1); err != nil {
+		t.Fatalf("Get with restored session: %v", err)
+	}
+	if got := s.RequestCount(http.MethodPost, "/login"); got != logins {
+		t.Errorf("restored session logged in again: %d logins, want %d", got, logins)
+	}
+
+	if err := b.LoadSession(store, "team"); !errors.Is(err, htbapi.ErrProfileNotFound) {
+		t.Errorf("LoadSession of unknown profile error = %v, want ErrProfileNotFound", err)
+	}
+}
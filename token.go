@@ -0,0 +1,283 @@
+package htbapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultTokenEnv is the environment variable read by EnvTokenSource if no other one is given
+const DefaultTokenEnv = "HTB_TOKEN"
+
+// Token holds the credentials used as Bearer Token for authorized requests
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	// Expiry is the time the access_token expires. The zero value means it never expires.
+	Expiry time.Time
+}
+
+// Valid reports whether the token is set and does not expire within DefaultRefreshSkew
+func (t *Token) Valid() bool {
+	return t.validFor(DefaultRefreshSkew)
+}
+
+// validFor reports whether the token is set and does not expire within skew
+func (t *Token) validFor(skew time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	if t.Expiry.IsZero() {
+		return true
+	}
+
+	return time.Now().Add(skew).Before(t.Expiry)
+}
+
+// TokenSource provides the token for every authorized request.
+// Implementations have to be safe for concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// WithTokenSource sets the source used to authorize requests.
+// It defaults to PasswordTokenSource of the created API.
+func WithTokenSource(ts TokenSource) Option {
+	return func(a *API) error {
+		if ts == nil {
+			return fmt.Errorf("%s", "token source must not be nil")
+		}
+
+		a.tokenSource = ts
+		return nil
+	}
+}
+
+// WithAppToken authorizes all requests with a HTB App Token.
+// No interactive login is needed then.
+func WithAppToken(token string) Option {
+	return WithTokenSource(StaticTokenSource(token))
+}
+
+// newToken will construct a Token and take the expiry from the access_token if possible
+func newToken(accessToken, refreshToken string) *Token {
+	t := &Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+
+	if claims, err := ParseToken(accessToken); err == nil {
+		t.Expiry = claims.ExpiresAt
+	}
+
+	return t
+}
+
+// staticTokenSource always returns the same token
+type staticTokenSource struct {
+	token *Token
+}
+
+// StaticTokenSource returns a TokenSource which always returns token.
+// Use it with long-lived HTB App Tokens.
+func StaticTokenSource(token string) TokenSource {
+	return &staticTokenSource{token: newToken(token, "")}
+}
+
+// Token implements TokenSource
+func (s *staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	if !s.token.Valid() {
+		return nil, fmt.Errorf("%s", "static token is empty or expired")
+	}
+
+	return s.token, nil
+}
+
+// envTokenSource reads the token from an environment variable
+type envTokenSource struct {
+	key string
+}
+
+// EnvTokenSource returns a TokenSource which reads the token from the environment
+// variable key on every call. If key is empty DefaultTokenEnv is used.
+func EnvTokenSource(key string) TokenSource {
+	if key == "" {
+		key = DefaultTokenEnv
+	}
+
+	return &envTokenSource{key: key}
+}
+
+// Token implements TokenSource
+func (s *envTokenSource) Token(ctx context.Context) (*Token, error) {
+	t := newToken(os.Getenv(s.key), "")
+	if !t.Valid() {
+		return nil, fmt.Errorf("token in env %s is empty or expired", s.key)
+	}
+
+	return t, nil
+}
+
+// passwordTokenSource uses the login and refresh of an API
+type passwordTokenSource struct {
+	a *API
+}
+
+// PasswordTokenSource returns a TokenSource using the session of a. If there is no
+// session yet it will login with password and OTP. The access_token is refreshed
+// before it expires. Concurrent calls share one login and one refresh.
+// This is the default TokenSource of every API.
+func PasswordTokenSource(a *API) TokenSource {
+	return &passwordTokenSource{a: a}
+}
+
+// Token implements TokenSource
+func (s *passwordTokenSource) Token(ctx context.Context) (*Token, error) {
+	if err := s.a.login(ctx); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.a.validToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, refreshToken := s.a.credentials()
+
+	return newToken(accessToken, refreshToken), nil
+}
+
+// refreshToken renews the expired token t with its refresh_token, see tokenRefresher.
+// If a has a session of its own already that one is used instead.
+func (s *passwordTokenSource) refreshToken(ctx context.Context, t *Token) (*Token, error) {
+	if token, _ := s.a.credentials(); token != "" && token != t.AccessToken {
+		return s.Token(ctx)
+	}
+
+	details := s.a.sessionDetails()
+	details.AccessToken, details.RefreshToken = t.AccessToken, t.RefreshToken
+	s.a.setCredentials(details)
+
+	if err := s.a.refresh(ctx, t.AccessToken); err != nil {
+		return nil, err
+	}
+
+	return newToken(s.a.credentials()), nil
+}
+
+// tokenRefresher is implemented by token sources which can renew an expired token
+// with its refresh_token
+type tokenRefresher interface {
+	refreshToken(ctx context.Context, t *Token) (*Token, error)
+}
+
+// fileTokenSource caches the tokens of another source in a file
+type fileTokenSource struct {
+	path string
+	src  TokenSource
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// FileTokenSource returns a TokenSource which reads the token from the session cache
+// file at path as written by DumpSessionToCache. An expired token is renewed with its
+// refresh_token if src supports it, like PasswordTokenSource does. Otherwise, or if
+// that fails, a new token is fetched from src. New tokens are written to path.
+func FileTokenSource(path string, src TokenSource) TokenSource {
+	return &fileTokenSource{path: path, src: src}
+}
+
+// Token implements TokenSource
+func (s *fileTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	skew := s.skew()
+	if s.token.validFor(skew) {
+		return s.token, nil
+	}
+
+	cached, err := s.load()
+	if err == nil && cached.validFor(skew) {
+		s.token = cached
+		return cached, nil
+	}
+	if err != nil {
+		cached = s.token
+	}
+
+	if s.src == nil {
+		return nil, fmt.Errorf("no valid session in cache file %s", s.path)
+	}
+
+	t, err := s.renew(ctx, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.save(t); err != nil {
+		return nil, err
+	}
+	s.token = t
+
+	return t, nil
+}
+
+// skew returns how long before their expiry tokens are renewed. Tokens of an API
+// are renewed at its refresh skew, so the file does not hand out tokens it would refresh.
+func (s *fileTokenSource) skew() time.Duration {
+	if p, ok := s.src.(*passwordTokenSource); ok {
+		return p.a.refreshSkew
+	}
+
+	return DefaultRefreshSkew
+}
+
+// renew refreshes the expired token cached if possible and falls back to src
+func (s *fileTokenSource) renew(ctx context.Context, cached *Token) (*Token, error) {
+	if r, ok := s.src.(tokenRefresher); ok && cached != nil && cached.RefreshToken != "" {
+		if t, err := r.refreshToken(ctx, cached); err == nil {
+			return t, nil
+		}
+	}
+
+	return s.src.Token(ctx)
+}
+
+// load reads the token from the cache file
+func (s *fileTokenSource) load() (*Token, error) {
+	cache, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionCache LoginResponseMessage
+	if err := json.Unmarshal(cache, &sessionCache); err != nil {
+		return nil, err
+	}
+
+	return newToken(sessionCache.AccessToken, sessionCache.RefreshToken), nil
+}
+
+// save writes the token to the cache file
+func (s *fileTokenSource) save(t *Token) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	file, err := json.MarshalIndent(LoginResponseMessage{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path, file, 0600)
+}
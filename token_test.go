@@ -0,0 +1,179 @@
+package htbapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+// countingPrompter answers with the default account and counts how often it was asked
+type countingPrompter struct {
+	otp   string
+	asked int32
+}
+
+func (p *countingPrompter) Email(ctx context.Context) (string, error) {
+	atomic.AddInt32(&p.asked, 1)
+	return htbtest.DefaultEmail, nil
+}
+
+func (p *countingPrompter) Password(ctx context.Context) (string, error) {
+	return htbtest.DefaultPassword, nil
+}
+
+func (p *countingPrompter) OTP(ctx context.Context) (string, error) {
+	// Leaves other requests time to see the token of the first login step
+	time.Sleep(20 * time.Millisecond)
+	return p.otp, nil
+}
+
+func TestPasswordTokenSourceSingleLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.Enable2FA("123456")
+
+	p := &countingPrompter{otp: "123456"}
+	a := newTestAPI(t, s, htbapi.WithCredentials("", "", false), htbapi.WithPrompter(p))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.Machines.Get(context.Background(), 1)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Get: %v", err)
+		}
+	}
+	if p.asked != 1 {
+		t.Errorf("prompter asked %d times, want 1", p.asked)
+	}
+	if n := s.RequestCount(http.MethodPost, "/login"); n != 1 {
+		t.Errorf("%d login requests, want 1", n)
+	}
+	if n := s.RequestCount(http.MethodPost, "/2fa/login"); n != 1 {
+		t.Errorf("%d 2fa requests, want 1", n)
+	}
+}
+
+func TestFileTokenSourceRefresh(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	// Cache a session whose access_token is about to expire
+	s.SetTokenTTL(5 * time.Second)
+	cached := newTestAPI(t, s)
+	login(t, cached)
+	if err := cached.DumpSessionToCache(path); err != nil {
+		t.Fatalf("DumpSessionToCache: %v", err)
+	}
+	s.SetTokenTTL(time.Hour)
+
+	// The source has no credentials, so only a refresh can renew the token
+	src := newTestAPI(t, s, htbapi.WithCredentials("", "", false))
+	a := newTestAPI(t, s, htbapi.WithTokenSource(htbapi.FileTokenSource(path, htbapi.PasswordTokenSource(src))))
+
+	if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if n := s.RequestCount(http.MethodPost, "/login"); n != 1 {
+		t.Errorf("%d login requests, want only the one of the cached session", n)
+	}
+	if n := s.RequestCount(http.MethodPost, "/login/refresh"); n != 1 {
+		t.Errorf("%d refresh requests, want 1", n)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session htbapi.LoginResponseMessage
+	if err := json.Unmarshal(raw, &session); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := htbapi.ParseToken(session.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.ExpiresIn() < 30*time.Minute {
+		t.Errorf("cached token expires in %s, want the refreshed one", claims.ExpiresIn())
+	}
+}
+
+func TestTokenValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		token *htbapi.Token
+		want  bool
+	}{
+		{"nil", nil, false},
+		{"empty", &htbapi.Token{}, false},
+		{"no expiry", &htbapi.Token{AccessToken: "token"}, true},
+		{"valid", &htbapi.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, true},
+		{"within refresh skew", &htbapi.Token{AccessToken: "token", Expiry: time.Now().Add(htbapi.DefaultRefreshSkew / 2)}, false},
+		{"expired", &htbapi.Token{AccessToken: "token", Expiry: time.Now().Add(-time.Minute)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.token.Valid(); got != tt.want {
+				t.Errorf("Valid = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTokenSourceRefreshSkew(t *testing.T) {
+	tests := []struct {
+		skew      time.Duration
+		refreshes int
+	}{
+		// The cached token expires in 30s
+		{time.Minute, 1},
+		{10 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.skew.String(), func(t *testing.T) {
+			s := newTestServer(t)
+			s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+			path := filepath.Join(t.TempDir(), "session.json")
+
+			s.SetTokenTTL(30 * time.Second)
+			cached := newTestAPI(t, s)
+			login(t, cached)
+			if err := cached.DumpSessionToCache(path); err != nil {
+				t.Fatalf("DumpSessionToCache: %v", err)
+			}
+			s.SetTokenTTL(time.Hour)
+
+			src := newTestAPI(t, s, htbapi.WithCredentials("", "", false), htbapi.WithRefreshSkew(tt.skew))
+			a := newTestAPI(t, s, htbapi.WithTokenSource(htbapi.FileTokenSource(path, htbapi.PasswordTokenSource(src))))
+
+			if _, err := a.Machines.Get(context.Background(), 1); err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if n := s.RequestCount(http.MethodPost, "/login/refresh"); n != tt.refreshes {
+				t.Errorf("%d refresh requests, want %d", n, tt.refreshes)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package htbapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TOTP generates time based one time passwords as described in RFC 6238.
+// It uses HMAC-SHA1, a period of 30 seconds and 6 digits like authenticator apps do.
+type TOTP struct {
+	secret []byte
+	digits int
+	period time.Duration
+}
+
+// NewTOTP returns a TOTP for the base32 encoded secret. Spaces, dashes and
+// missing padding as shown by most 2FA setup pages are accepted.
+func NewTOTP(secret string) (*TOTP, error) {
+	s := strings.ToUpper(secret)
+	s = strings.NewReplacer(" ", "", "-", "", "=", "").Replace(s)
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp secret: %+v", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s", "totp secret must not be empty")
+	}
+
+	return &TOTP{
+		secret: key,
+		digits: 6,
+		period: 30 * time.Second,
+	}, nil
+}
+
+// Code returns the one time password valid at t
+func (t *TOTP) Code(at time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(at.Unix()/int64(t.period/time.Second)))
+
+	mac := hmac.New(sha1.New, t.secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation as of RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < t.digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.digits, code%mod)
+}
+
+// OTP implements OTPProvider by returning the code valid right now
+func (t *TOTP) OTP(ctx context.Context) (string, error) {
+	return t.Code(time.Now()), nil
+}
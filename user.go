@@ -1 +1,122 @@
 package htbapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// UserInfo holds the account details of the logged in user
+type UserInfo struct {
+	Avatar              string `json:"avatar"`
+	BetaTester          int    `json:"beta_tester"`
+	CanAccessVIP        bool   `json:"canAccessVIP"`
+	Email               string `json:"email"`
+	ID                  int    `json:"id"`
+	IsDedicatedVIP      bool   `json:"isDedicatedVip"`
+	IsModerator         bool   `json:"isModerator"`
+	IsServerVIP         bool   `json:"isServerVIP"`
+	IsVIP               bool   `json:"isVip"`
+	Name                string `json:"name"`
+	OnboardingCompleted bool   `json:"onboarding_completed"`
+	RankID              int    `json:"rank_id"`
+	ServerID            int    `json:"server_id"`
+	Timezone            string `json:"timezone"`
+}
+
+// UserProfile holds the public profile of a user
+type UserProfile struct {
+	Avatar              string   `json:"avatar"`
+	CountryCode         string   `json:"country_code"`
+	CountryName         string   `json:"country_name"`
+	CurrentRankProgress float64  `json:"current_rank_progress"`
+	Description         string   `json:"description"`
+	Github              string   `json:"github"`
+	ID                  int      `json:"id"`
+	IsDedicatedVIP      bool     `json:"isDedicatedVip"`
+	IsRespected         bool     `json:"isRespected"`
+	IsVIP               bool     `json:"isVip"`
+	Linkedin            string   `json:"linkedin"`
+	Name                string   `json:"name"`
+	NextRank            string   `json:"next_rank"`
+	Points              int      `json:"points"`
+	Rank                string   `json:"rank"`
+	RankID              int      `json:"rank_id"`
+	Ranking             int      `json:"ranking"`
+	Respects            int      `json:"respects"`
+	SystemBloods        int      `json:"system_bloods"`
+	SystemOwns          int      `json:"system_owns"`
+	Team                UserTeam `json:"team"`
+	Timezone            string   `json:"timezone"`
+	Twitter             string   `json:"twitter"`
+	UniversityName      string   `json:"university_name"`
+	UserBloods          int      `json:"user_bloods"`
+	UserOwns            int      `json:"user_owns"`
+	Website             string   `json:"website"`
+}
+
+// UserTeam is the team shown in a user profile
+type UserTeam struct {
+	Avatar  string `json:"avatar"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Ranking int    `json:"ranking"`
+}
+
+// GetUserInfoResponse is used to construct the response to /user/info
+type GetUserInfoResponse struct {
+	Info UserInfo `json:"info"`
+}
+
+// GetUserProfileResponse is used to construct the response to /user/profile/basic/<id>
+type GetUserProfileResponse struct {
+	Profile UserProfile `json:"profile"`
+}
+
+// UserActivity is an entry of the activity of a user, e.g. an own or a first blood
+type UserActivity struct {
+	Date              string `json:"date"`
+	DateDiff          string `json:"date_diff"`
+	ObjectType        string `json:"object_type"`
+	Type              string `json:"type"`
+	FirstBlood        bool   `json:"first_blood"`
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Points            int    `json:"points"`
+	MachineAvatar     string `json:"machine_avatar"`
+	ChallengeCategory string `json:"challenge_category"`
+}
+
+// UsersService handles the user accounts
+type UsersService service
+
+// Info returns the account details of the logged in user
+func (s *UsersService) Info(ctx context.Context) (UserInfo, error) {
+	resp, err := Do[GetUserInfoResponse](ctx, s.api, http.MethodGet, "/user/info", nil)
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	return resp.Info, nil
+}
+
+// Profile returns the public profile of the user with id
+func (s *UsersService) Profile(ctx context.Context, id int) (UserProfile, error) {
+	resp, err := Do[GetUserProfileResponse](ctx, s.api, http.MethodGet, fmt.Sprintf("/user/profile/basic/%s", strconv.Itoa(id)), nil)
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	return resp.Profile, nil
+}
+
+// Activity returns an iterator over the activity of the user with id, latest first.
+// It follows the pages if the api paginates the activity.
+func (s *UsersService) Activity(ctx context.Context, id int) *Iterator[UserActivity] {
+	endpoint := fmt.Sprintf("/user/profile/activity/%s", strconv.Itoa(id))
+
+	return NewIterator(ctx, func(ctx context.Context, page int) (Page[UserActivity], error) {
+		return listPage[UserActivity](ctx, s.api, endpoint, page, "profile", "activity")
+	})
+}
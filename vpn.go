@@ -1,8 +1,9 @@
 package htbapi
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/http"
 )
 
 // Connections represents the connection details of all vpn endpoints
@@ -29,9 +30,21 @@ type AssignedServer struct {
 	Location       string `json:"location"`
 }
 
-// GetCurrentVPNServer will give you VPNServer information by giving it one of the possible endpoints
-// (also see EnumVPNEndpoints)
-func (a *API) GetCurrentVPNServer(search string) (VPNServer, error) {
+// VPNService handles the vpn servers
+type VPNService service
+
+// Servers returns the vpn server of every vpn endpoint (see EnumVPNEndpoints) by endpoint
+func (s *VPNService) Servers(ctx context.Context) (map[string]VPNServer, error) {
+	connections, err := Do[Connections](ctx, s.api, http.MethodGet, "/connections", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return connections.Data, nil
+}
+
+// Current returns the vpn server of one of the vpn endpoints (see EnumVPNEndpoints)
+func (s *VPNService) Current(ctx context.Context, search string) (VPNServer, error) {
 	vs := VPNServer{}
 
 	found := false
@@ -44,16 +57,25 @@ func (a *API) GetCurrentVPNServer(search string) (VPNServer, error) {
 		return vs, fmt.Errorf("you have to specify a valid vpn endpoint. Those are: %+v", EnumVPNEndpoints)
 	}
 
-	connectionsBody, _, err := a.DoRequest("/connections", nil, true, false)
+	servers, err := s.Servers(ctx)
 	if err != nil {
-		return VPNServer{}, err
-	}
-	defer connectionsBody.Close()
-
-	var connections Connections
-	if err := json.NewDecoder(connectionsBody).Decode(&connections); err != nil {
 		return vs, err
 	}
 
-	return connections.Data[search], nil
+	return servers[search], nil
+}
+
+// GetCurrentVPNServer will give you VPNServer information by giving it one of the possible endpoints
+// (also see EnumVPNEndpoints)
+//
+// Deprecated: Use a.VPN.Current.
+func (a *API) GetCurrentVPNServer(search string) (VPNServer, error) {
+	return a.VPN.Current(context.Background(), search)
+}
+
+// GetCurrentVPNServerContext is like GetCurrentVPNServer but uses ctx for the request.
+//
+// Deprecated: Use a.VPN.Current.
+func (a *API) GetCurrentVPNServerContext(ctx context.Context, search string) (VPNServer, error) {
+	return a.VPN.Current(ctx, search)
 }
@@ -0,0 +1,234 @@
+package htbapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrWaitTimeout is returned if a machine did not get ready within WaitOptions.Timeout
+var ErrWaitTimeout = errors.New("timed out waiting for machine")
+
+// Defaults of WaitOptions
+const (
+	DefaultPollInterval    = 2 * time.Second
+	DefaultMaxPollInterval = 15 * time.Second
+	DefaultWaitTimeout     = 5 * time.Minute
+	DefaultDialTimeout     = 3 * time.Second
+)
+
+// SpawnStage is the stage a machine is in while waiting for it
+type SpawnStage int
+
+const (
+	// StageRequested means the spawn request was accepted
+	StageRequested SpawnStage = iota
+	// StageSpawning means the machine is still spawning or has no ip yet
+	StageSpawning
+	// StageSpawned means the machine is up and has an ip
+	StageSpawned
+	// StageWaitingForPort means the port does not accept connections yet
+	StageWaitingForPort
+	// StageReady means waiting is done
+	StageReady
+)
+
+// String returns the name of the stage
+func (s SpawnStage) String() string {
+	switch s {
+	case StageRequested:
+		return "requested"
+	case StageSpawning:
+		return "spawning"
+	case StageSpawned:
+		return "spawned"
+	case StageWaitingForPort:
+		return "waiting for port"
+	case StageReady:
+		return "ready"
+	}
+
+	return fmt.Sprintf("SpawnStage(%d)", int(s))
+}
+
+// SpawnProgress is passed to WaitOptions.Progress whenever the state of the machine was checked
+type SpawnProgress struct {
+	Stage SpawnStage
+	// Attempt counts the checks within the stage starting at 1
+	Attempt int
+	// Elapsed is the time since waiting started
+	Elapsed time.Duration
+	// Instance is the latest known state of the machine
+	Instance MachineInstance
+	// Err is the error of the last check, if any. Waiting continues anyway.
+	Err error
+}
+
+// WaitOptions configures SpawnAndWait and WaitReady. The zero value uses the defaults.
+type WaitOptions struct {
+	// PollInterval is the first delay between two checks. It grows up to MaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// Timeout limits the whole wait. The context may end it earlier.
+	Timeout time.Duration
+	// Port is a tcp port which has to accept connections before the machine counts
+	// as ready. Zero skips the check.
+	Port        int
+	DialTimeout time.Duration
+	// Dial opens the connection to check Port, e.g. through a proxy.
+	// It defaults to a net.Dialer.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// Progress is called after every check
+	Progress func(SpawnProgress)
+}
+
+// withDefaults fills all unset options
+func (o WaitOptions) withDefaults() WaitOptions {
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultPollInterval
+	}
+	if o.MaxPollInterval < o.PollInterval {
+		o.MaxPollInterval = DefaultMaxPollInterval
+		if o.MaxPollInterval < o.PollInterval {
+			o.MaxPollInterval = o.PollInterval
+		}
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultWaitTimeout
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = DefaultDialTimeout
+	}
+	if o.Dial == nil {
+		d := &net.Dialer{Timeout: o.DialTimeout}
+		o.Dial = d.DialContext
+	}
+
+	return o
+}
+
+// SpawnAndWait spawns the machine with id in arena and blocks until it is spawned,
+// has an ip and, if opts.Port is set, accepts connections on that port.
+// It fails with ErrWaitTimeout once opts.Timeout passed.
+func (s *MachinesService) SpawnAndWait(ctx context.Context, id int, arena Arena, opts WaitOptions) (MachineInstance, error) {
+	e, err := arena.endpoints()
+	if err != nil {
+		return MachineInstance{}, err
+	}
+
+	opts = opts.withDefaults()
+	start := time.Now()
+
+	if err := s.spawn(ctx, id, e); err != nil {
+		return MachineInstance{}, err
+	}
+	opts.progress(SpawnProgress{Stage: StageRequested, Attempt: 1, Elapsed: time.Since(start)})
+
+	return s.wait(ctx, arena, opts, start)
+}
+
+// WaitReady blocks until the machine already spawned in arena is ready, see SpawnAndWait
+func (s *MachinesService) WaitReady(ctx context.Context, arena Arena, opts WaitOptions) (MachineInstance, error) {
+	if _, err := arena.endpoints(); err != nil {
+		return MachineInstance{}, err
+	}
+
+	return s.wait(ctx, arena, opts.withDefaults(), time.Now())
+}
+
+// wait polls the active machine with backoff until it is ready
+func (s *MachinesService) wait(ctx context.Context, arena Arena, opts WaitOptions, start time.Time) (MachineInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout-time.Since(start))
+	defer cancel()
+
+	timeout := func(lastErr error) error {
+		if lastErr != nil {
+			return fmt.Errorf("%w after %s: %v", ErrWaitTimeout, time.Since(start).Round(time.Millisecond), lastErr)
+		}
+		return fmt.Errorf("%w after %s", ErrWaitTimeout, time.Since(start).Round(time.Millisecond))
+	}
+
+	var (
+		mi      MachineInstance
+		lastErr error
+	)
+
+	interval := opts.PollInterval
+	for attempt := 1; ; attempt++ {
+		mi, lastErr = s.Active(ctx, arena)
+		if lastErr != nil && (ctx.Err() != nil || errors.Is(lastErr, ErrUnauthorized)) {
+			if ctx.Err() == context.DeadlineExceeded {
+				return mi, timeout(lastErr)
+			}
+			return mi, lastErr
+		}
+
+		if lastErr == nil && spawned(mi) {
+			opts.progress(SpawnProgress{Stage: StageSpawned, Attempt: attempt, Elapsed: time.Since(start), Instance: mi})
+			break
+		}
+		opts.progress(SpawnProgress{Stage: StageSpawning, Attempt: attempt, Elapsed: time.Since(start), Instance: mi, Err: lastErr})
+
+		if err := sleep(ctx, interval); err != nil {
+			if err == context.DeadlineExceeded {
+				return mi, timeout(lastErr)
+			}
+			return mi, err
+		}
+		interval = nextInterval(interval, opts.MaxPollInterval)
+	}
+
+	if opts.Port > 0 {
+		address := net.JoinHostPort(mi.IP, strconv.Itoa(opts.Port))
+
+		interval = opts.PollInterval
+		for attempt := 1; ; attempt++ {
+			dialCtx, cancelDial := context.WithTimeout(ctx, opts.DialTimeout)
+			conn, err := opts.Dial(dialCtx, "tcp", address)
+			cancelDial()
+			if err == nil {
+				conn.Close()
+				break
+			}
+			opts.progress(SpawnProgress{Stage: StageWaitingForPort, Attempt: attempt, Elapsed: time.Since(start), Instance: mi, Err: err})
+
+			if err := sleep(ctx, interval); err != nil {
+				if err == context.DeadlineExceeded {
+					return mi, timeout(fmt.Errorf("port %d is closed", opts.Port))
+				}
+				return mi, err
+			}
+			interval = nextInterval(interval, opts.MaxPollInterval)
+		}
+	}
+
+	opts.progress(SpawnProgress{Stage: StageReady, Attempt: 1, Elapsed: time.Since(start), Instance: mi})
+
+	return mi, nil
+}
+
+// progress calls the Progress callback if set
+func (o WaitOptions) progress(p SpawnProgress) {
+	if o.Progress != nil {
+		o.Progress(p)
+	}
+}
+
+// spawned reports whether the active endpoint reports the machine as spawned
+// and it has an ip
+func spawned(mi MachineInstance) bool {
+	return mi.IsSpawned && !mi.IsSpawning && mi.IP != ""
+}
+
+// nextInterval grows the poll interval by half up to max
+func nextInterval(d, max time.Duration) time.Duration {
+	d += d / 2
+	if d > max {
+		return max
+	}
+
+	return d
+}
@@ -0,0 +1,154 @@
+package htbapi_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patrickhener/go-htbapi"
+	"github.com/patrickhener/go-htbapi/htbtest"
+)
+
+func TestSpawnAndWait(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.SetSpawnDelay(300 * time.Millisecond)
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	var stages []htbapi.SpawnStage
+	mi, err := a.Machines.SpawnAndWait(context.Background(), 1, htbapi.Lab, htbapi.WaitOptions{
+		PollInterval: 50 * time.Millisecond,
+		Timeout:      5 * time.Second,
+		Progress:     func(p htbapi.SpawnProgress) { stages = append(stages, p.Stage) },
+	})
+	if err != nil {
+		t.Fatalf("SpawnAndWait: %v", err)
+	}
+	if mi.IP == "" || !mi.Machine.PlayInfo.IsSpawend {
+		t.Errorf("machine not spawned: ip=%q playInfo=%+v", mi.IP, mi.Machine.PlayInfo)
+	}
+	if len(stages) < 3 || stages[0] != htbapi.StageRequested || stages[len(stages)-1] != htbapi.StageReady {
+		t.Errorf("stages = %v", stages)
+	}
+}
+
+func TestSpawnAndWaitReleaseArena(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.SetReleaseArenaMachine(1)
+	s.SetSpawnDelay(300 * time.Millisecond)
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	mi, err := a.Machines.SpawnAndWait(context.Background(), 1, htbapi.ReleaseArena, htbapi.WaitOptions{
+		PollInterval: 50 * time.Millisecond,
+		Timeout:      5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("SpawnAndWait: %v", err)
+	}
+	if mi.IP == "" || !mi.IsSpawned || mi.IsSpawning {
+		t.Errorf("machine not spawned: ip=%q spawned=%v spawning=%v", mi.IP, mi.IsSpawned, mi.IsSpawning)
+	}
+}
+
+func TestSpawnAndWaitReleaseArenaSpawning(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.SetReleaseArenaMachine(1)
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	// The active endpoint hands out the ip before the machine is up
+	s.InjectFault(htbtest.Fault{
+		Method:     http.MethodGet,
+		PathPrefix: "/release_arena/active",
+		Status:     http.StatusOK,
+		Body:       `{"info":{"id":1,"name":"Lame","ip":"10.10.11.2","isSpawning":true}}`,
+		Times:      3,
+	})
+
+	if _, err := a.Machines.SpawnAndWait(context.Background(), 1, htbapi.ReleaseArena, htbapi.WaitOptions{
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      5 * time.Second,
+	}); err != nil {
+		t.Fatalf("SpawnAndWait: %v", err)
+	}
+	if n := s.RequestCount(http.MethodGet, "/release_arena/active"); n < 4 {
+		t.Errorf("%d polls, want it to wait while the machine is spawning", n)
+	}
+}
+
+func TestSpawnAndWaitWithCache(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.SetSpawnDelay(300 * time.Millisecond)
+
+	a := newTestAPI(t, s, htbapi.WithCache(htbapi.NewLRUCache(100), htbapi.DefaultCachePolicy()))
+	login(t, a)
+
+	mi, err := a.Machines.SpawnAndWait(context.Background(), 1, htbapi.Lab, htbapi.WaitOptions{
+		PollInterval: 50 * time.Millisecond,
+		Timeout:      2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("SpawnAndWait: %v", err)
+	}
+	if mi.IP == "" {
+		t.Error("machine has no ip")
+	}
+}
+
+func TestSpawnAndWaitPort(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	dials := 0
+	_, err := a.Machines.SpawnAndWait(context.Background(), 1, htbapi.Lab, htbapi.WaitOptions{
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      5 * time.Second,
+		Port:         22,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dials++
+			if dials < 3 {
+				return nil, errors.New("connection refused")
+			}
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("SpawnAndWait: %v", err)
+	}
+	if dials != 3 {
+		t.Errorf("dialed %d times, want 3", dials)
+	}
+}
+
+func TestSpawnAndWaitTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.AddMachine(htbapi.Machine{ID: 1, Name: "Lame"}, "user", "root")
+	s.SetSpawnDelay(time.Hour)
+
+	a := newTestAPI(t, s)
+	login(t, a)
+
+	_, err := a.Machines.SpawnAndWait(context.Background(), 1, htbapi.Lab, htbapi.WaitOptions{
+		PollInterval: 20 * time.Millisecond,
+		Timeout:      200 * time.Millisecond,
+	})
+	if !errors.Is(err, htbapi.ErrWaitTimeout) {
+		t.Fatalf("err = %v, want ErrWaitTimeout", err)
+	}
+}